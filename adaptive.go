@@ -0,0 +1,231 @@
+package leakybucketgcra
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdaptiveKey       = "gcra:adaptive"
+	defaultAdaptiveInterval  = time.Second
+	defaultAdaptiveDecrease  = 0.5
+	defaultAdaptiveErrorRate = 0.05
+
+	// adaptiveSamples caps the latencies kept per interval for the p99.
+	adaptiveSamples = 1024
+)
+
+// AdaptiveOptions configures an Adaptive controller.
+type AdaptiveOptions struct {
+	// Base is the limit every class starts from. Its Rate is adjusted and
+	// its Burst scaled in proportion.
+	Base Limit
+
+	// Min and Max bound the adjusted rate. They default to 1 and Base.Rate.
+	Min, Max int64
+
+	// Increase is added to the rate after a healthy interval. Defaults to a
+	// tenth of Base.Rate.
+	Increase int64
+
+	// Decrease multiplies the rate after an unhealthy interval. Defaults
+	// to 0.5.
+	Decrease float64
+
+	// ErrorRate is the fraction of failed requests above which an interval
+	// is unhealthy. Defaults to 0.05.
+	ErrorRate float64
+
+	// LatencyTarget makes an interval unhealthy when its p99 latency
+	// exceeds it. Zero ignores latency.
+	LatencyTarget time.Duration
+
+	// Interval is how often the rate is adjusted and refreshed from Redis.
+	// Defaults to 1s.
+	Interval time.Duration
+
+	// Key is the Redis hash holding the current rates. Defaults to
+	// "gcra:adaptive".
+	Key string
+
+	// Clock is the time source. Defaults to time.Now.
+	Clock func() time.Time
+}
+
+// Adaptive adjusts the rate of classes of keys from backend health using
+// additive increase and multiplicative decrease (AIMD): the rate grows by
+// Increase after every healthy interval and is cut by Decrease after an
+// unhealthy one. Rates are stored in Redis and changed at most once per
+// interval across all instances, so every instance converges on the same
+// value. Adaptive implements LimitProvider; use it with WithLimitProvider
+// and AllowNamed, naming limits by class.
+type Adaptive struct {
+	rdb  Client
+	opts AdaptiveOptions
+
+	mu      sync.Mutex
+	classes map[string]*adaptiveClass
+}
+
+var _ LimitProvider = (*Adaptive)(nil)
+
+// adaptiveClass is the local view of one class: its last known rate and the
+// feedback gathered during the current interval.
+type adaptiveClass struct {
+	mu        sync.Mutex
+	rate      int64
+	refreshed time.Time
+	started   time.Time
+	ok        int64
+	failed    int64
+	latencies []time.Duration
+}
+
+// NewAdaptive returns an Adaptive controller storing rates through rdb.
+func NewAdaptive(rdb Client, opts AdaptiveOptions) (*Adaptive, error) {
+	if err := opts.Base.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max <= 0 {
+		opts.Max = opts.Base.Rate
+	}
+	if opts.Min > opts.Max {
+		return nil, fmt.Errorf("%w: adaptive Min %d is above Max %d", ErrInvalidLimit, opts.Min, opts.Max)
+	}
+	if opts.Increase <= 0 {
+		opts.Increase = max(opts.Base.Rate/10, 1)
+	}
+	if opts.Decrease <= 0 || opts.Decrease >= 1 {
+		opts.Decrease = defaultAdaptiveDecrease
+	}
+	if opts.ErrorRate <= 0 {
+		opts.ErrorRate = defaultAdaptiveErrorRate
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultAdaptiveInterval
+	}
+	if opts.Key == "" {
+		opts.Key = defaultAdaptiveKey
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &Adaptive{rdb: rdb, opts: opts, classes: make(map[string]*adaptiveClass)}, nil
+}
+
+// Limit implements LimitProvider. It returns the current limit of class,
+// reading it from Redis at most once per Interval. If Redis cannot be read
+// the last known limit is returned.
+func (a *Adaptive) Limit(class string) (Limit, bool) {
+	c := a.class(class)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := a.opts.Clock(); now.Sub(c.refreshed) >= a.opts.Interval {
+		var raw interface{}
+		if err := a.rdb.DoCmd(&raw, "HGET", a.opts.Key, class); err == nil {
+			if s, err := normalizeString(raw); err == nil && s != "" {
+				if rate, err := strconv.ParseInt(s, 10, 64); err == nil {
+					c.rate = rate
+				}
+			}
+			c.refreshed = now
+		}
+	}
+	return a.limit(c.rate), true
+}
+
+// Feedback reports the outcome of one request to the backend protected by
+// class. Once per Interval the gathered feedback decides whether the rate
+// goes up or down; the returned error reports a failure to store the new
+// rate.
+func (a *Adaptive) Feedback(class string, ok bool, latency time.Duration) error {
+	c := a.class(class)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := a.opts.Clock()
+	if c.started.IsZero() {
+		c.started = now
+	}
+	if ok {
+		c.ok++
+	} else {
+		c.failed++
+	}
+	if a.opts.LatencyTarget > 0 && len(c.latencies) < adaptiveSamples {
+		c.latencies = append(c.latencies, latency)
+	}
+	if now.Sub(c.started) < a.opts.Interval {
+		return nil
+	}
+
+	verdict := 1
+	if !a.healthy(c) {
+		verdict = -1
+	}
+	c.started, c.ok, c.failed, c.latencies = now, 0, 0, c.latencies[:0]
+
+	var resp []interface{}
+	err := a.rdb.EvalScript(&resp, adaptScriptSrc, []string{a.opts.Key},
+		class,
+		strconv.Itoa(verdict),
+		strconv.FormatInt(a.opts.Base.Rate, 10),
+		strconv.FormatInt(a.opts.Min, 10),
+		strconv.FormatInt(a.opts.Max, 10),
+		strconv.FormatInt(a.opts.Increase, 10),
+		strconv.FormatFloat(a.opts.Decrease, 'f', -1, 64),
+		strconv.FormatFloat(a.opts.Interval.Seconds(), 'f', -1, 64),
+	)
+	if err != nil {
+		return backendErr(err)
+	}
+	if len(resp) != 1 {
+		return fmt.Errorf("%w: got %d items, want 1", ErrUnexpectedResponse, len(resp))
+	}
+	rate, err := strconv.ParseInt(fmt.Sprint(resp[0]), 10, 64)
+	if err != nil {
+		return responseErr("parse rate", err)
+	}
+	c.rate, c.refreshed = rate, now
+	return nil
+}
+
+// healthy reports whether the feedback gathered in c's interval is within
+// the error rate and latency targets.
+func (a *Adaptive) healthy(c *adaptiveClass) bool {
+	if float64(c.failed) > a.opts.ErrorRate*float64(c.ok+c.failed) {
+		return false
+	}
+	if a.opts.LatencyTarget > 0 && len(c.latencies) > 0 {
+		slices.Sort(c.latencies)
+		p99 := c.latencies[int(math.Ceil(0.99*float64(len(c.latencies))))-1]
+		return p99 <= a.opts.LatencyTarget
+	}
+	return true
+}
+
+func (a *Adaptive) class(name string) *adaptiveClass {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.classes[name]
+	if !ok {
+		c = &adaptiveClass{rate: a.opts.Base.Rate}
+		a.classes[name] = c
+	}
+	return c
+}
+
+// limit scales Base to rate, keeping the ratio of burst to rate.
+func (a *Adaptive) limit(rate int64) Limit {
+	l := a.opts.Base
+	l.Burst = int64(math.Ceil(float64(l.Burst) * float64(rate) / float64(l.Rate)))
+	l.Rate = rate
+	return l
+}
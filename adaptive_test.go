@@ -0,0 +1,84 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestAdaptive(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	opts := gcra.AdaptiveOptions{
+		Base:          gcra.PerSecond(100, 200),
+		Min:           10,
+		Max:           120,
+		Increase:      10,
+		LatencyTarget: 100 * time.Millisecond,
+		Clock:         clock.Now,
+	}
+	a, err := gcra.NewAdaptive(mock, opts)
+	require.NoError(t, err)
+	other, err := gcra.NewAdaptive(mock, opts)
+	require.NoError(t, err)
+
+	interval := func(ok bool, latency time.Duration) {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, a.Feedback("payments", ok, latency))
+		}
+		clock.Advance(time.Second)
+		require.NoError(t, a.Feedback("payments", true, time.Millisecond))
+	}
+	limit := func(a *gcra.Adaptive, class string) gcra.Limit {
+		limit, ok := a.Limit(class)
+		require.True(t, ok)
+		return limit
+	}
+	rate := func(a *gcra.Adaptive) int64 { return limit(a, "payments").Rate }
+	assert.Equal(t, gcra.PerSecond(100, 200), limit(a, "payments"))
+
+	// Healthy intervals raise the rate up to Max.
+	interval(true, 10*time.Millisecond)
+	assert.Equal(t, int64(110), rate(a))
+	interval(true, 10*time.Millisecond)
+	interval(true, 10*time.Millisecond)
+	assert.Equal(t, gcra.PerSecond(120, 240), limit(a, "payments"))
+
+	// Errors halve it; slow responses too.
+	interval(false, 10*time.Millisecond)
+	assert.Equal(t, int64(60), rate(a))
+	interval(true, time.Second)
+	assert.Equal(t, int64(30), rate(a))
+	interval(false, time.Second)
+	interval(false, time.Second)
+	assert.Equal(t, int64(10), rate(a), "never below Min")
+
+	// Other instances pick up the shared rate, and classes are independent.
+	assert.Equal(t, int64(10), rate(other))
+	assert.Equal(t, int64(100), limit(other, "search").Rate)
+}
+
+func TestAdaptiveAsLimitProvider(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	a, err := gcra.NewAdaptive(mock, gcra.AdaptiveOptions{Base: gcra.PerSecond(1, 1), Clock: clock.Now})
+	require.NoError(t, err)
+	limiter := gcra.NewLimiter(mock, gcra.WithLimitProvider(a))
+
+	res, err := limiter.AllowNamed("merchant:42", "payments")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestNewAdaptiveValidates(t *testing.T) {
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	_, err := gcra.NewAdaptive(mock, gcra.AdaptiveOptions{})
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = gcra.NewAdaptive(mock, gcra.AdaptiveOptions{Base: gcra.PerSecond(10, 10), Min: 20})
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
@@ -0,0 +1,75 @@
+package leakybucketgcra
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Algorithm selects how a Limit is enforced. The zero value is GCRA.
+type Algorithm int
+
+const (
+	// AlgorithmGCRA smooths requests to Rate per Period while allowing
+	// bursts of up to Burst.
+	AlgorithmGCRA Algorithm = iota
+
+	// AlgorithmFixedWindow allows Rate requests per calendar-aligned
+	// window of length Period: windows start at multiples of Period since
+	// the Unix epoch, so an hourly window runs from :00 to :00 UTC.
+	AlgorithmFixedWindow
+
+	// AlgorithmSlidingWindowLog allows Rate requests in any Period, exactly,
+	// by logging every request in a sorted set. Memory grows with Rate.
+	AlgorithmSlidingWindowLog
+
+	// AlgorithmSlidingWindowCounter approximates a sliding window by
+	// weighting the previous fixed window's count by how much of it still
+	// overlaps the sliding one. It uses constant memory per key.
+	AlgorithmSlidingWindowCounter
+)
+
+var algorithmNames = map[Algorithm]string{
+	AlgorithmGCRA:                 "gcra",
+	AlgorithmFixedWindow:          "fixed_window",
+	AlgorithmSlidingWindowLog:     "sliding_window_log",
+	AlgorithmSlidingWindowCounter: "sliding_window_counter",
+}
+
+// String returns the algorithm name as accepted by ParseLimit, for example
+// "fixed_window".
+func (a Algorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+func parseAlgorithm(s string) (Algorithm, error) {
+	s = strings.NewReplacer(" ", "_", "-", "_").Replace(s)
+	for a, name := range algorithmNames {
+		if s == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", s)
+}
+
+// windowed reports whether a uses windows rather than GCRA. Windowed limits
+// allow Rate requests per window and ignore Burst.
+func (a Algorithm) windowed() bool {
+	return a != AlgorithmGCRA
+}
+
+// windowScript is the script and Redis key of a windowed algorithm. Window
+// scripts take the same arguments and return the same fields as
+// allowNScriptSrc, followed by a request id used to tell log entries apart.
+type windowScript struct {
+	src    string
+	suffix string // appended to the rate limit key so algorithms never share state
+}
+
+var windowScripts = map[Algorithm]windowScript{
+	AlgorithmFixedWindow:          {fixedWindowScriptSrc, ":fw"},
+	AlgorithmSlidingWindowLog:     {slidingWindowLogScriptSrc, ":swl"},
+	AlgorithmSlidingWindowCounter: {slidingWindowCounterScriptSrc, ":swc"},
+}
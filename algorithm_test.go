@@ -0,0 +1,151 @@
+package leakybucketgcra_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestFixedWindowIsCalendarAligned(t *testing.T) {
+	clock := testmock.NewTestTime(time.Date(2026, 3, 1, 10, 59, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	limit := gcra.Limit{Rate: 3, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow}
+
+	res, err := limiter.AllowN("user:42", limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.Equal(t, time.Minute, *res.ResetAfter)
+
+	res, err = limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, time.Minute, *res.RetryAfter)
+
+	// The window ends at 11:00, not an hour after the first request.
+	clock.Advance(time.Minute)
+	res, err = limiter.AllowN("user:42", limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+
+	res, err = limiter.AllowN("user:42", limit, 4)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonCostExceedsBurst, res.Reason)
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	clock := testmock.NewTestTime(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	limit := gcra.Limit{Rate: 3, Period: time.Minute, Algorithm: gcra.AlgorithmSlidingWindowLog}
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow("user:42", limit)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), res.Allowed)
+		assert.Equal(t, int64(2-i), res.Remaining)
+		clock.Advance(10 * time.Second)
+	}
+
+	// The first request leaves the window 60s after it was made.
+	res, err := limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 30*time.Second, *res.RetryAfter)
+	assert.Equal(t, 50*time.Second, *res.ResetAfter)
+
+	res, err = limiter.AllowN("user:42", limit, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 40*time.Second, *res.RetryAfter)
+
+	clock.Advance(30 * time.Second)
+	res, err = limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	clock := testmock.NewTestTime(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	limit := gcra.Limit{Rate: 10, Period: time.Minute, Algorithm: gcra.AlgorithmSlidingWindowCounter}
+
+	res, err := limiter.AllowN("user:42", limit, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Allowed)
+
+	// A quarter into the next window, 75% of the previous window's count
+	// still applies, leaving room for 2 requests.
+	clock.Advance(75 * time.Second)
+	res, err = limiter.AllowN("user:42", limit, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	res, err = limiter.AllowN("user:42", limit, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 9*time.Second, *res.RetryAfter)
+}
+
+func TestAlgorithmsKeepSeparateState(t *testing.T) {
+	clock := testmock.NewTestTime(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	fixed := gcra.Limit{Rate: 1, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow}
+
+	limiter.Allow("user:42", fixed)
+	res, err := limiter.Allow("user:42", gcra.PerHour(1, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+
+	require.NoError(t, limiter.Reset("user:42"))
+	res, err = limiter.Allow("user:42", fixed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestParseLimitAlgorithm(t *testing.T) {
+	for in, want := range map[string]gcra.Limit{
+		"1000/h fixed_window":        {Rate: 1000, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow},
+		"1000 req/h (fixed window)":  {Rate: 1000, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow},
+		"5/m, sliding-window-log":    {Rate: 5, Period: time.Minute, Algorithm: gcra.AlgorithmSlidingWindowLog},
+		"5/m sliding_window_counter": {Rate: 5, Period: time.Minute, Algorithm: gcra.AlgorithmSlidingWindowCounter},
+		"10 req/s (burst 20) (gcra)": gcra.PerSecond(10, 20),
+		"10 req/s (burst 20)":        gcra.PerSecond(10, 20),
+	} {
+		got, err := gcra.ParseLimit(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+
+		again, err := gcra.ParseLimit(got.String())
+		require.NoError(t, err, got.String())
+		assert.Equal(t, got, again)
+	}
+
+	assert.Equal(t, "1000 req/h (fixed_window)",
+		gcra.Limit{Rate: 1000, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow}.String())
+
+	for _, in := range []string{"10/s burst 5 fixed_window", "10/s leaky"} {
+		_, err := gcra.ParseLimit(in)
+		assert.ErrorIs(t, err, gcra.ErrInvalidLimit, in)
+	}
+
+	// A windowed Limit with a Burst would not survive the round trip.
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	_, err := limiter.Allow("user:42", gcra.Limit{Rate: 10, Burst: 10, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow})
+	var limitErr *gcra.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "Burst", limitErr.Field)
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	_, err := limiter.Allow("user:42", gcra.Limit{Rate: 1, Period: time.Second, Algorithm: 9})
+	var limitErr *gcra.LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "Algorithm", limitErr.Field)
+}
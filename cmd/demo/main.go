@@ -40,8 +40,8 @@ func main() {
 	if err != nil {
 		log.Fatalf("allowN: %v", err)
 	}
-	fmt.Printf("cost=5 allowed=%d remaining=%d retry_after=%v reset_after=%v\n",
-		res.Allowed, res.Remaining, res.RetryAfter, res.ResetAfter)
+	fmt.Printf("cost=5 allowed=%d remaining=%d retry_after=%v reset_after=%v reason=%s\n",
+		res.Allowed, res.Remaining, res.RetryAfter, res.ResetAfter, res.Reason)
 
 	fmt.Println("\nWait 1s and try again (cost=1)...")
 	time.Sleep(1000 * time.Millisecond)
@@ -0,0 +1,111 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultCoalesceWindow = time.Microsecond
+
+// WithCoalescing makes concurrent AllowN calls on the same key and limit
+// share one script call. The first call waits window (default 1µs) for
+// others to join, then the batch is decided in a single round trip, granting
+// in arrival order exactly as separate calls arriving at the same instant
+// would be.
+func WithCoalescing(window time.Duration) Option {
+	return func(l *Limiter) {
+		if window <= 0 {
+			window = defaultCoalesceWindow
+		}
+		l.coalescer = &coalescer{window: window, batches: make(map[batchKey]*batch)}
+	}
+}
+
+type batchKey struct {
+	key   string
+	limit Limit
+}
+
+// batch collects the requests for one key that will share a script call.
+type batch struct {
+	costs   []int64
+	results []*RateLimitResult
+	err     error
+	done    chan struct{}
+}
+
+type coalescer struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	batches map[batchKey]*batch
+}
+
+// allowCoalesced adds a request for n tokens to the pending batch for key and
+// limit, starting one if needed, and waits for its result.
+func (l Limiter) allowCoalesced(ctx context.Context, key string, limit Limit, n int64) (*RateLimitResult, error) {
+	c := l.coalescer
+	bk := batchKey{key, limit}
+
+	c.mu.Lock()
+	b, ok := c.batches[bk]
+	if !ok {
+		b = &batch{done: make(chan struct{})}
+		c.batches[bk] = b
+		flushCtx := context.WithoutCancel(ctx)
+		time.AfterFunc(c.window, func() {
+			c.mu.Lock()
+			delete(c.batches, bk)
+			c.mu.Unlock()
+			b.results, b.err = l.runBatch(flushCtx, key, limit, b.costs)
+			close(b.done)
+		})
+	}
+	i := len(b.costs)
+	b.costs = append(b.costs, n)
+	c.mu.Unlock()
+
+	<-b.done
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.results[i], nil
+}
+
+func (l Limiter) runBatch(ctx context.Context, key string, limit Limit, costs []int64) ([]*RateLimitResult, error) {
+	if len(costs) == 1 {
+		res, err := l.runAllow(ctx, key, limit, costs[0], 0, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*RateLimitResult{res}, nil
+	}
+
+	args := []interface{}{
+		strconv.FormatInt(limit.Burst, 10),
+		strconv.FormatInt(limit.Rate, 10),
+		strconv.FormatFloat(limit.Period.Seconds(), 'f', -1, 64),
+	}
+	for _, cost := range costs {
+		args = append(args, strconv.FormatInt(cost, 10))
+	}
+	var resp []interface{}
+	if err := l.evalScript(ctx, &resp, allowBatchScriptSrc, []string{redisPrefix + key}, args...); err != nil {
+		return nil, err
+	}
+	if len(resp) != 5*len(costs) {
+		return nil, fmt.Errorf("%w: got %d items, want %d", ErrUnexpectedResponse, len(resp), 5*len(costs))
+	}
+	results := make([]*RateLimitResult, len(costs))
+	for i := range results {
+		res, err := parseResult(limit, resp[5*i:5*i+5])
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+	return results, nil
+}
@@ -0,0 +1,80 @@
+package leakybucketgcra_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+// lockedCountingClient counts script executions from many goroutines.
+type lockedCountingClient struct {
+	gcra.Client
+	mu    sync.Mutex
+	evals int
+}
+
+func (c *lockedCountingClient) EvalScript(rcv interface{}, script string, keys []string, args ...interface{}) error {
+	c.mu.Lock()
+	c.evals++
+	c.mu.Unlock()
+	return c.Client.EvalScript(rcv, script, keys, args...)
+}
+
+func TestCoalescing(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &lockedCountingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithCoalescing(50*time.Millisecond))
+	limit := gcra.PerSecond(1, 10)
+
+	results := make([]*gcra.RateLimitResult, 15)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := limiter.Allow("user:42", limit)
+			assert.NoError(t, err)
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	var allowed int64
+	remaining := map[int64]bool{}
+	for _, res := range results {
+		require.NotNil(t, res)
+		allowed += res.Allowed
+		if res.Allowed > 0 {
+			remaining[res.Remaining] = true
+		} else {
+			assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+		}
+	}
+	assert.Equal(t, int64(10), allowed)
+	assert.Len(t, remaining, 10, "each allowed request sees its own Remaining")
+	assert.Less(t, rdb.evals, len(results))
+}
+
+func TestCoalescingKeepsKeysApart(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithCoalescing(time.Millisecond))
+	limit := gcra.PerSecond(1, 1)
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := limiter.Allow(key, limit)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), res.Allowed)
+		}()
+	}
+	wg.Wait()
+}
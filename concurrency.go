@@ -0,0 +1,169 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultSlotTTL = 30 * time.Second
+
+// ConcurrencyOptions configures a ConcurrencyLimiter.
+type ConcurrencyOptions struct {
+	// LeaseTTL is how long a slot is held without being renewed. Slots of a
+	// process that crashed are freed once their lease expires. Defaults to
+	// 30s.
+	LeaseTTL time.Duration
+}
+
+// ConcurrencyLimiter caps in-flight work per key, such as the number of
+// concurrent exports per tenant, across all processes sharing Redis. Slots
+// are leases in a sorted set: long-running work must Renew its slot before
+// LeaseTTL elapses.
+type ConcurrencyLimiter struct {
+	l   Limiter
+	ttl time.Duration
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter storing slots through
+// rdb, without metrics, tracing or logging. Use Limiter.Concurrency to
+// instrument it like the Limiter.
+func NewConcurrencyLimiter(rdb Client, opts ConcurrencyOptions) *ConcurrencyLimiter {
+	return NewLimiter(rdb).Concurrency(opts)
+}
+
+// Concurrency returns a ConcurrencyLimiter storing slots through the
+// Limiter's Client. Its scripts are reported to the Limiter's Recorder and
+// tracer, and backend errors to its logger.
+func (l Limiter) Concurrency(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = defaultSlotTTL
+	}
+	return &ConcurrencyLimiter{l: l, ttl: opts.LeaseTTL}
+}
+
+// SlotsFullError reports that no concurrency slot was free. It matches
+// ErrLimited with errors.Is.
+type SlotsFullError struct {
+	InUse int64 // slots held for the key
+	Max   int64 // slots allowed for the key
+
+	// RetryAfter is when the earliest held lease expires unless renewed.
+	// Slots are usually released sooner.
+	RetryAfter time.Duration
+}
+
+func (e *SlotsFullError) Error() string {
+	return fmt.Sprintf("%v: %d of %d concurrency slots in use", ErrLimited, e.InUse, e.Max)
+}
+
+func (e *SlotsFullError) Unwrap() error { return ErrLimited }
+
+// Slot is a held concurrency slot. Release it when the work is done.
+type Slot struct {
+	c   *ConcurrencyLimiter
+	key string
+	id  string
+
+	// InUse is the number of slots held for the key, including this one,
+	// when it was acquired.
+	InUse int64
+
+	once sync.Once
+}
+
+// Acquire takes one of max slots for key. When all are held it returns a
+// *SlotsFullError.
+func (c *ConcurrencyLimiter) Acquire(key string, max int64) (*Slot, error) {
+	if max <= 0 {
+		return nil, fmt.Errorf("%w: concurrency limit must be greater than zero", ErrInvalidLimit)
+	}
+	id := strconv.FormatUint(rand.Uint64(), 36) + strconv.FormatUint(rand.Uint64(), 36)
+
+	var resp []interface{}
+	err := c.eval(&resp, "Acquire", key, acquireSlotScriptSrc,
+		strconv.FormatInt(max, 10),
+		strconv.FormatFloat(c.ttl.Seconds(), 'f', -1, 64),
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 3 {
+		return nil, fmt.Errorf("%w: got %d items, want 3", ErrUnexpectedResponse, len(resp))
+	}
+	acquired, err := strconv.ParseInt(fmt.Sprint(resp[0]), 10, 64)
+	if err != nil {
+		return nil, responseErr("parse acquired", err)
+	}
+	inUse, err := strconv.ParseInt(fmt.Sprint(resp[1]), 10, 64)
+	if err != nil {
+		return nil, responseErr("parse in use", err)
+	}
+	if acquired == 0 {
+		retryAfter, err := parseDurationSeconds(resp[2])
+		if err != nil {
+			return nil, responseErr("parse retry_after", err)
+		}
+		full := &SlotsFullError{InUse: inUse, Max: max}
+		if retryAfter != nil {
+			full.RetryAfter = *retryAfter
+		}
+		return nil, full
+	}
+	return &Slot{c: c, key: key, id: id, InUse: inUse}, nil
+}
+
+// Renew extends the slot's lease by LeaseTTL from now. It returns
+// ErrSlotExpired if the lease already expired; the work should then stop,
+// as the slot may have been given to someone else.
+func (s *Slot) Renew() error {
+	var resp []interface{}
+	err := s.c.eval(&resp, "Renew", s.key, renewSlotScriptSrc,
+		strconv.FormatFloat(s.c.ttl.Seconds(), 'f', -1, 64),
+		s.id,
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return fmt.Errorf("%w: got %d items, want 1", ErrUnexpectedResponse, len(resp))
+	}
+	if fmt.Sprint(resp[0]) == "0" {
+		return ErrSlotExpired
+	}
+	return nil
+}
+
+// Release frees the slot. Calling it more than once has no effect.
+func (s *Slot) Release() error {
+	var err error
+	s.once.Do(func() {
+		var resp []interface{}
+		err = s.c.eval(&resp, "Release", s.key, releaseSlotScriptSrc, s.id)
+	})
+	return err
+}
+
+// eval runs script on the slots of key for method, tracing the call and
+// logging backend errors.
+func (c *ConcurrencyLimiter) eval(rcv interface{}, method, key, script string, args ...interface{}) error {
+	ctx, span := c.l.tracer.Start(context.Background(), "gcra."+method, trace.WithAttributes(keyHashAttr(key)))
+	defer span.End()
+	err := c.l.evalScript(ctx, rcv, script, []string{c.slotsKey(key)}, args...)
+	if err != nil {
+		c.l.log.backendError(ctx, strings.ToLower(method), key, nil, err, false)
+		spanError(span, err)
+	}
+	return err
+}
+
+func (c *ConcurrencyLimiter) slotsKey(key string) string {
+	return redisPrefix + key + ":slots"
+}
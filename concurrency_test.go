@@ -0,0 +1,85 @@
+package leakybucketgcra_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	sem := gcra.NewConcurrencyLimiter(testmock.NewMockClient(clock), gcra.ConcurrencyOptions{LeaseTTL: time.Minute})
+
+	first, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first.InUse)
+	second, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), second.InUse)
+
+	clock.Advance(10 * time.Second)
+	_, err = sem.Acquire("exports:acme", 2)
+	assert.ErrorIs(t, err, gcra.ErrLimited)
+	var full *gcra.SlotsFullError
+	require.True(t, errors.As(err, &full))
+	assert.Equal(t, gcra.SlotsFullError{InUse: 2, Max: 2, RetryAfter: 50 * time.Second}, *full)
+
+	// Other keys have their own slots.
+	_, err = sem.Acquire("exports:globex", 2)
+	require.NoError(t, err)
+
+	require.NoError(t, first.Release())
+	require.NoError(t, first.Release())
+	third, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), third.InUse)
+}
+
+func TestConcurrencySlotsExpireUnlessRenewed(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	sem := gcra.NewConcurrencyLimiter(testmock.NewMockClient(clock), gcra.ConcurrencyOptions{LeaseTTL: time.Minute})
+
+	renewed, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+	leaked, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+
+	clock.Advance(45 * time.Second)
+	require.NoError(t, renewed.Renew())
+	clock.Advance(45 * time.Second)
+
+	// The leaked slot expired; the renewed one is still held.
+	assert.ErrorIs(t, leaked.Renew(), gcra.ErrSlotExpired)
+	slot, err := sem.Acquire("exports:acme", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), slot.InUse)
+	_, err = sem.Acquire("exports:acme", 2)
+	assert.ErrorIs(t, err, gcra.ErrLimited)
+}
+
+func TestConcurrencyLimiterRejectsZeroMax(t *testing.T) {
+	sem := gcra.NewConcurrencyLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))), gcra.ConcurrencyOptions{})
+	_, err := sem.Acquire("exports:acme", 0)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
+
+func TestConcurrencyLimiterIsInstrumented(t *testing.T) {
+	var buf bytes.Buffer
+	rec := &decisionRecorder{}
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(failingClient{mock}, gcra.WithRecorder(rec),
+		gcra.WithLogger(newTestLogger(&buf), gcra.LogOptions{RawKeys: true}))
+	sem := limiter.Concurrency(gcra.ConcurrencyOptions{})
+
+	_, err := sem.Acquire("exports:acme", 1)
+	assert.ErrorIs(t, err, gcra.ErrBackendUnavailable)
+	assert.Equal(t, 1, rec.scriptErrs)
+	assert.Contains(t, buf.String(), `msg="rate limit backend failure" op=acquire key=exports:acme`)
+}
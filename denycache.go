@@ -0,0 +1,133 @@
+package leakybucketgcra
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// WithDenyCache remembers up to size recent denials in process. Until a
+// denied key's RetryAfter elapses, further AllowN calls for it with the same
+// limit and at least the same cost are answered locally instead of running
+// the script, shedding load from Redis during floods. The least recently
+// denied keys are evicted first. Hits are reported to the Recorder.
+//
+// Cached answers may be stale: the real wait ends sooner when the bucket is
+// reset, its override changes, leased tokens are returned or a reservation
+// is cancelled. Resets through this Limiter, and override changes made or
+// announced through pub/sub to it, drop the affected entries; other changes
+// go unnoticed until the cached RetryAfter elapses.
+func WithDenyCache(size int) Option {
+	return func(l *Limiter) {
+		if size > 0 {
+			l.denials = newDenyCache(size)
+		}
+	}
+}
+
+// WithClock sets the time source used for local decisions such as the deny
+// cache. Defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+type denial struct {
+	key     string
+	limit   Limit
+	cost    int64
+	reserve float64   // tokens held back from the denied request
+	until   time.Time // when the denied cost fits again
+	reset   time.Time // when the bucket is full again
+}
+
+// denyCache is a bounded LRU of recent denials.
+type denyCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is most recent
+	items map[string]*list.Element
+}
+
+func newDenyCache(size int) *denyCache {
+	return &denyCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// lookup returns a synthesized denial if key is known to be denied for
+// limit, cost and reserve at now.
+func (c *denyCache) lookup(key string, limit Limit, cost int64, reserve float64, now time.Time) (*RateLimitResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	d := el.Value.(*denial)
+	if !now.Before(d.until) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	if d.limit != limit || cost < d.cost || reserve < d.reserve {
+		return nil, false
+	}
+	retryAfter := d.until.Sub(now)
+	resetAfter := d.reset.Sub(now)
+	return &RateLimitResult{
+		Limit:      limit,
+		RetryAfter: &retryAfter,
+		ResetAfter: &resetAfter,
+		Reason:     ReasonRateExceeded,
+	}, true
+}
+
+// add records a denial reported by Redis.
+func (c *denyCache) add(key string, cost int64, reserve float64, res *RateLimitResult, now time.Time) {
+	if res.Reason != ReasonRateExceeded || res.RetryAfter == nil {
+		return
+	}
+	d := &denial{key: key, limit: res.Limit, cost: cost, reserve: reserve, until: now.Add(*res.RetryAfter), reset: now}
+	if res.ResetAfter != nil {
+		d.reset = now.Add(*res.ResetAfter)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value = d
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(d)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*denial).key)
+	}
+}
+
+// removeFunc drops the entries whose key satisfies match.
+func (c *denyCache) removeFunc(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if match(key) {
+			c.order.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
+
+func (c *denyCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
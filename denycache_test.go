@@ -0,0 +1,111 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+// countingClient counts script executions.
+type countingClient struct {
+	gcra.Client
+	evals int
+}
+
+func (c *countingClient) EvalScript(rcv interface{}, script string, keys []string, args ...interface{}) error {
+	c.evals++
+	return c.Client.EvalScript(rcv, script, keys, args...)
+}
+
+func TestDenyCache(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithDenyCache(10), gcra.WithClock(clock.Now))
+	limit := gcra.PerSecond(1, 1)
+
+	res, err := limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	res, err = limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, 2, rdb.evals)
+
+	// Answered locally with a decreasing RetryAfter.
+	clock.Advance(400 * time.Millisecond)
+	res, err = limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.Equal(t, 600*time.Millisecond, *res.RetryAfter)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, 2, rdb.evals)
+
+	// A different limit still goes to Redis.
+	limiter.Allow("user:42", gcra.PerSecond(2, 2))
+	assert.Equal(t, 3, rdb.evals)
+
+	// Once RetryAfter elapses the request is allowed again.
+	clock.Advance(600 * time.Millisecond)
+	res, err = limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, 4, rdb.evals)
+}
+
+func TestDenyCacheReset(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithDenyCache(10), gcra.WithClock(clock.Now))
+	limit := gcra.PerSecond(1, 1)
+
+	limiter.Allow("user:42", limit)
+	limiter.Allow("user:42", limit)
+	require.NoError(t, limiter.Reset("user:42"))
+	res, err := limiter.Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestDenyCacheDroppedOnOverrideChange(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	limiter := gcra.NewLimiter(mock,
+		gcra.WithOverrides(gcra.OverrideOptions{}),
+		gcra.WithDenyCache(10),
+		gcra.WithClock(clock.Now),
+	)
+	require.NoError(t, limiter.SetOverride("acme", gcra.PerSecond(1, 1)))
+	limiter.Allow("acme", gcra.PerSecond(5, 5))
+	res, err := limiter.Allow("acme", gcra.PerSecond(5, 5))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), res.Allowed)
+
+	// Another process resets the bucket and the override is saved again.
+	require.NoError(t, gcra.NewLimiter(mock).Reset("acme"))
+	require.NoError(t, limiter.SetOverride("acme", gcra.PerSecond(1, 1)))
+	res, err = limiter.Allow("acme", gcra.PerSecond(5, 5))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestDenyCacheEvictsLeastRecent(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithDenyCache(1), gcra.WithClock(clock.Now))
+	limit := gcra.PerSecond(1, 1)
+
+	for _, key := range []string{"a", "a", "b", "b"} {
+		limiter.Allow(key, limit)
+	}
+	evals := rdb.evals
+	limiter.Allow("b", limit)
+	assert.Equal(t, evals, rdb.evals)
+	limiter.Allow("a", limit)
+	assert.Equal(t, evals+1, rdb.evals)
+}
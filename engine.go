@@ -0,0 +1,131 @@
+package leakybucketgcra
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// scriptEpoch is the zero of the times the scripts compute with and store,
+// 2017-01-01 UTC. Measuring from a recent epoch keeps float precision.
+const scriptEpoch = 1483228800
+
+// State is the stored state of one GCRA bucket.
+type State struct {
+	// TAT is the bucket's theoretical arrival time, the value the scripts
+	// keep in Redis: seconds since 2017-01-01 UTC.
+	TAT float64
+
+	// Exists is false for a bucket with no stored state, because it is new,
+	// expired or was reset. Such a bucket is full.
+	Exists bool
+}
+
+// Decide applies the GCRA to a bucket in state at now and returns the
+// decision and the bucket's new state. It is the arithmetic of the script
+// AllowN runs in Redis, operation for operation: given the same state and
+// time, the result is identical, so tests, in-memory backends and offline
+// tools can decide exactly as Redis would. now is truncated to the
+// microsecond, the resolution of the Redis clock. Only GCRA limits are
+// supported.
+func Decide(state State, limit Limit, cost int64, now time.Time) (*RateLimitResult, State, error) {
+	return DecidePriority(state, limit, cost, PriorityCritical, PriorityReserves{}, now)
+}
+
+// DecidePriority is like Decide, but decides a request of priority p as
+// AllowNPriority does on a Limiter configured with WithPriorityReserves(r).
+func DecidePriority(state State, limit Limit, cost int64, p Priority, r PriorityReserves, now time.Time) (*RateLimitResult, State, error) {
+	if err := validateDecide(limit); err != nil {
+		return nil, state, err
+	}
+	reserve := r.normalized().tokens(limit, p)
+	return decideStep(state, limit, cost, float64(limit.Burst), float64(limit.Rate), reserve, now)
+}
+
+// DecideShare is like Decide, but decides the bucket of a tenant holding
+// share of limit, as AllowFair does for a FairShare with that Limit. share
+// is the FairShareResult.Share of the decision, between 0 (exclusive) and 1.
+// The tenant may always spend one request that fits the whole burst.
+func DecideShare(state State, limit Limit, cost int64, share float64, now time.Time) (*RateLimitResult, State, error) {
+	if err := validateDecide(limit); err != nil {
+		return nil, state, err
+	}
+	if limit.Overdraft != 0 {
+		return nil, state, &LimitError{Limit: limit, Field: "Overdraft", Msg: "is not supported for fair sharing"}
+	}
+	if !(share > 0 && share <= 1) {
+		return nil, state, fmt.Errorf("%w: share %g is not in (0, 1]", ErrInvalidLimit, share)
+	}
+	burst, c := float64(limit.Burst), float64(cost)
+	return decideStep(state, limit, cost, math.Max(float64(burst*share), math.Min(c, burst)), float64(limit.Rate)*share, 0, now)
+}
+
+func validateDecide(limit Limit) error {
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	if limit.Algorithm.windowed() {
+		return &LimitError{Limit: limit, Field: "Algorithm", Msg: "is not supported by Decide"}
+	}
+	return nil
+}
+
+// decideStep runs gcraStep for a bucket of the given burst and rate per
+// limit.Period and reports the result under limit.
+func decideStep(state State, limit Limit, cost int64, burst, rate, reserve float64, now time.Time) (*RateLimitResult, State, error) {
+	reply, next := gcraStep(state, burst, rate, limit.Period.Seconds(),
+		float64(cost), reserve, float64(limit.Overdraft), scriptTime(now))
+	res, err := parseResult(limit, reply)
+	if err != nil {
+		return nil, state, err
+	}
+	return res, next, nil
+}
+
+// scriptTime converts now to seconds since the script epoch as the scripts
+// do with the reply of TIME.
+func scriptTime(now time.Time) float64 {
+	return float64(now.Unix()-scriptEpoch) + float64(now.Nanosecond()/1000)/1000000
+}
+
+// gcraStep mirrors allowNScriptSrc and returns its reply. Products are
+// converted explicitly so the compiler cannot fuse them into multiply-adds,
+// which Lua does not do.
+func gcraStep(state State, burst, rate, period, cost, reserve, overdraft, now float64) ([]interface{}, State) {
+	emissionInterval := period / rate
+	increment := float64(emissionInterval * cost)
+	burstOffset := float64(emissionInterval * (burst - reserve + overdraft))
+
+	tat := now
+	if state.Exists {
+		tat = state.TAT
+	}
+
+	if cost > burst+overdraft {
+		return []interface{}{int64(0), int64(0), "-1", luaNumber(tat - now), int64(ReasonCostExceedsBurst)}, state
+	}
+	if cost > burst-reserve+overdraft {
+		return []interface{}{int64(0), int64(0), "-1", luaNumber(tat - now), int64(ReasonReserved)}, state
+	}
+
+	newTAT := math.Max(tat, now) + increment
+	allowAt := newTAT - burstOffset
+	diff := now - allowAt
+
+	if diff < 0 {
+		reason := ReasonReserved
+		if diff+float64(reserve*emissionInterval) < 0 {
+			reason = ReasonRateExceeded
+		}
+		return []interface{}{int64(0), int64(0), luaNumber(diff * -1), luaNumber(tat - now), int64(reason)}, state
+	}
+	remaining := math.Floor(diff/emissionInterval+0.5) - overdraft
+	return []interface{}{int64(cost), int64(remaining), "-1", luaNumber(newTAT - now), int64(ReasonAllowed)},
+		State{TAT: newTAT, Exists: true}
+}
+
+// luaNumber formats x as Lua's tostring does.
+func luaNumber(x float64) string {
+	return strconv.FormatFloat(x, 'g', 14, 64)
+}
@@ -0,0 +1,109 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+func TestDecide(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := gcra.PerSecond(10, 2)
+
+	res, state, err := gcra.Decide(gcra.State{}, limit, 1, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+	assert.Nil(t, res.RetryAfter)
+	assert.Equal(t, 100*time.Millisecond, *res.ResetAfter)
+	assert.True(t, state.Exists)
+	assert.Equal(t, 0.1, state.TAT)
+
+	res, state, err = gcra.Decide(state, limit, 1, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// Denials leave the state unchanged.
+	res, next, err := gcra.Decide(state, limit, 1, now)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, 100*time.Millisecond, *res.RetryAfter)
+	assert.Equal(t, 200*time.Millisecond, *res.ResetAfter)
+	assert.Equal(t, state, next)
+
+	res, _, err = gcra.Decide(state, limit, 1, now.Add(101*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestDecideReportsLongWaits(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := gcra.PerMinute(1, 2)
+
+	_, state, err := gcra.Decide(gcra.State{}, limit, 2, now)
+	require.NoError(t, err)
+	res, _, err := gcra.Decide(state, limit, 1, now)
+	require.NoError(t, err)
+	require.NotNil(t, res.RetryAfter, "waits longer than the burst are reported as the script reports them")
+	assert.Equal(t, time.Minute, *res.RetryAfter)
+}
+
+func TestDecideEdgeCases(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	res, state, err := gcra.Decide(gcra.State{}, gcra.PerSecond(1, 5), 6, now)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonCostExceedsBurst, res.Reason)
+	assert.Nil(t, res.RetryAfter)
+	assert.False(t, state.Exists)
+
+	reserves := gcra.PriorityReserves{Normal: 0.3}
+	res, _, err = gcra.DecidePriority(gcra.State{}, gcra.PerSecond(10, 10), 8, gcra.PriorityNormal, reserves, now)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonReserved, res.Reason)
+	res, _, err = gcra.DecidePriority(gcra.State{}, gcra.PerSecond(10, 10), 8, gcra.PriorityCritical, reserves, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), res.Allowed)
+
+	res, _, err = gcra.Decide(gcra.State{}, gcra.Limit{Rate: 10, Burst: 10, Period: time.Second, Overdraft: 5}, 12, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), res.Remaining)
+
+	// The Redis clock has microsecond resolution.
+	_, a, err := gcra.Decide(gcra.State{}, gcra.PerSecond(1, 1), 1, now.Add(1500*time.Nanosecond))
+	require.NoError(t, err)
+	_, b, err := gcra.Decide(gcra.State{}, gcra.PerSecond(1, 1), 1, now.Add(time.Microsecond))
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	_, _, err = gcra.Decide(gcra.State{}, gcra.Limit{Rate: 1, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow}, 1, now)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, _, err = gcra.Decide(gcra.State{}, gcra.Limit{Burst: 1}, 1, now)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
+
+func TestDecideShare(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := gcra.PerSecond(10, 10)
+
+	// A quarter share holds 2.5 tokens refilling at 2.5 per second.
+	res, state, err := gcra.DecideShare(gcra.State{}, limit, 2, 0.25, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	res, _, err = gcra.DecideShare(state, limit, 1, 0.25, now)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, 200*time.Millisecond, *res.RetryAfter)
+
+	// A request fitting the global burst always fits the share.
+	res, _, err = gcra.DecideShare(gcra.State{}, limit, 10, 0.25, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Allowed)
+
+	_, _, err = gcra.DecideShare(gcra.State{}, limit, 1, 0, now)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
@@ -0,0 +1,78 @@
+package leakybucketgcra
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidLimit is returned for limits that can never be enforced.
+	// The concrete error is usually a *LimitError naming the offending field.
+	ErrInvalidLimit = errors.New("invalid limit")
+
+	// ErrCostExceedsBurst reports a request whose cost is larger than the
+	// limit's burst, so it can never be allowed.
+	ErrCostExceedsBurst = errors.New("cost exceeds burst")
+
+	// ErrBackendUnavailable wraps failures to reach Redis.
+	ErrBackendUnavailable = errors.New("rate limit backend unavailable")
+
+	// ErrUnexpectedResponse wraps error replies from Redis and responses the
+	// limiter could not parse.
+	ErrUnexpectedResponse = errors.New("unexpected rate limit backend response")
+
+	// ErrLimited reports a request denied because the rate was exceeded.
+	ErrLimited = errors.New("rate limited")
+
+	// ErrUnknownLimit is returned when a LimitProvider has no limit for a name.
+	ErrUnknownLimit = errors.New("unknown limit")
+
+	// ErrSlotExpired is returned when renewing a concurrency slot whose lease
+	// already expired, so it may have been given to another caller.
+	ErrSlotExpired = errors.New("concurrency slot expired")
+)
+
+// LimitError describes an invalid Limit. It matches ErrInvalidLimit with
+// errors.Is.
+type LimitError struct {
+	Limit Limit  // the rejected limit
+	Field string // offending field, such as "Rate", "Burst" or "Period"
+	Msg   string // what is wrong with the field
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v %q: %s %s", ErrInvalidLimit, e.Limit.String(), e.Field, e.Msg)
+}
+
+// Unwrap returns ErrInvalidLimit.
+func (e *LimitError) Unwrap() error {
+	return ErrInvalidLimit
+}
+
+// Err converts the decision into an error: nil when the request was allowed,
+// ErrCostExceedsBurst when it can never be allowed, and ErrLimited otherwise.
+func (r *RateLimitResult) Err() error {
+	switch r.Reason {
+	case ReasonCostExceedsBurst:
+		return ErrCostExceedsBurst
+	case ReasonRateExceeded, ReasonReserved:
+		return ErrLimited
+	default:
+		return nil
+	}
+}
+
+// backendErr classifies an error returned by a Client. Errors already
+// classified, such as those from RadixClient, are returned unchanged; others
+// are treated as the backend being unavailable.
+func backendErr(err error) error {
+	if err == nil || errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrUnexpectedResponse) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
+
+// responseErr wraps a failure to interpret a Redis reply.
+func responseErr(what string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrUnexpectedResponse, what, err)
+}
@@ -0,0 +1,59 @@
+package leakybucketgcra_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestErrorTaxonomy(t *testing.T) {
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock)
+
+	_, err := limiter.Allow("user:42", gcra.Limit{Rate: 0, Burst: 1, Period: time.Second})
+	require.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	var limitErr *gcra.LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "Rate", limitErr.Field)
+	assert.Equal(t, int64(1), limitErr.Limit.Burst)
+
+	_, err = gcra.ParseLimit("ten/s")
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+
+	_, err = limiter.AllowNamed("user:42", "api")
+	assert.ErrorIs(t, err, gcra.ErrUnknownLimit)
+
+	_, err = gcra.NewLimiter(failingClient{mock}).Allow("user:42", gcra.PerSecond(1, 1))
+	assert.ErrorIs(t, err, gcra.ErrBackendUnavailable)
+}
+
+func TestResultErr(t *testing.T) {
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock)
+	limit := gcra.PerSecond(1, 2)
+
+	res, err := limiter.AllowN("user:42", limit, 2)
+	require.NoError(t, err)
+	assert.NoError(t, res.Err())
+
+	res, err = limiter.AllowN("user:42", limit, 1)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.ErrorIs(t, res.Err(), gcra.ErrLimited)
+
+	res, err = limiter.AllowN("user:42", limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonCostExceedsBurst, res.Reason)
+	assert.ErrorIs(t, res.Err(), gcra.ErrCostExceedsBurst)
+
+	degraded, err := gcra.NewLimiter(failingClient{mock}, gcra.WithFailOpen()).Allow("user:42", limit)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonDegraded, degraded.Reason)
+	assert.NoError(t, degraded.Err())
+}
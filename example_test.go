@@ -85,6 +85,56 @@ func ExampleLimiter_Reset() {
 	// state after reset=none
 }
 
+func ExampleLimiter_AllowNamed() {
+	// example is just to show the behaviour, integrated with fake clock and client
+	// ; see the rules package for limits reloaded from a file.
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	limits := gcra.StaticLimits{"login": gcra.PerSecond(1, 2)}
+	limiter := gcra.NewLimiter(mock, gcra.WithLimitProvider(limits))
+
+	res1, _ := limiter.AllowNamed("login:alice", "login")
+	limiter.AllowNamed("login:alice", "login")
+	res2, _ := limiter.AllowNamed("login:alice", "login")
+	_, err := limiter.AllowNamed("login:alice", "signup")
+
+	fmt.Printf("first: allowed=%d limit=%s\n", res1.Allowed, res1.Limit)
+	fmt.Printf("third: allowed=%d retry_after=%s\n", res2.Allowed, formatDur(res2.RetryAfter))
+	fmt.Println(err)
+
+	// Output:
+	// first: allowed=1 limit=1 req/s (burst 2)
+	// third: allowed=0 retry_after=1.0s
+	// unknown limit "signup"
+}
+
+func ExampleLimiter_SetOverride() {
+	// example is just to show the behaviour, integrated with fake clock and client
+	// ; check cmd/ for real Redis usage.
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	limiter := gcra.NewLimiter(mock, gcra.WithOverrides(gcra.OverrideOptions{}))
+	limit := gcra.PerSecond(1, 1) // default: 1 req/sec, burst 1
+
+	before, _ := limiter.AllowN("tenant:acme", limit, 5)
+	limiter.SetOverride("tenant:acme", gcra.PerSecond(10, 10))
+	after, _ := limiter.AllowN("tenant:acme", limit, 5)
+	overrides, _ := limiter.ListOverrides()
+	limiter.ClearOverride("tenant:acme")
+	cleared, _ := limiter.AllowN("tenant:acme", limit, 5)
+
+	fmt.Printf("before override: allowed=%d limit=%s\n", before.Allowed, before.Limit)
+	fmt.Printf("with override: allowed=%d limit=%s reason=%s\n", after.Allowed, after.Limit, after.Reason)
+	fmt.Printf("stored overrides: %v\n", overrides)
+	fmt.Printf("after clear: allowed=%d limit=%s\n", cleared.Allowed, cleared.Limit)
+
+	// Output:
+	// before override: allowed=0 limit=1 req/s (burst 1)
+	// with override: allowed=5 limit=10 req/s (burst 10) reason=overridden
+	// stored overrides: map[tenant:acme:10 req/s (burst 10)]
+	// after clear: allowed=0 limit=1 req/s (burst 1)
+}
+
 func formatDur(d *time.Duration) string {
 	if d == nil {
 		return "none"
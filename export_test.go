@@ -0,0 +1,7 @@
+package leakybucketgcra
+
+// Internals exported for the tests in package leakybucketgcra_test.
+var (
+	AllowNScriptSrc = allowNScriptSrc
+	ParseResult     = parseResult
+)
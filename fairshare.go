@@ -0,0 +1,150 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultFairShareWindow = 10 * time.Second
+
+// FairShare is a global limit divided among the tenants using it. Each
+// tenant active within Window gets a share of Limit in proportion to its
+// weight, so no single tenant can starve the others, while a tenant alone
+// may use the whole limit.
+type FairShare struct {
+	// Key names the global bucket. Tenant buckets and the set of active
+	// tenants are stored under it.
+	Key string
+
+	// Limit is the global limit. Only GCRA limits without an overdraft are
+	// supported.
+	Limit Limit
+
+	// Window is how long a tenant counts as active after its last request.
+	// Defaults to 10s.
+	Window time.Duration
+}
+
+// FairShareResult reports a fair-share decision. The embedded
+// RateLimitResult holds the fields of whichever bucket limited the request,
+// the tenant's share or the global one; its Limit is always the global
+// limit.
+type FairShareResult struct {
+	RateLimitResult
+
+	// Share is the tenant's fraction of the global limit at the time of
+	// the request.
+	Share float64
+
+	// Active is the number of active tenants, including this one.
+	Active int64
+
+	// Global reports whether the global bucket, rather than the tenant's
+	// share, limited the request.
+	Global bool
+}
+
+// AllowFair charges n tokens to both tenant's share of fs and the global
+// bucket, atomically: the request is allowed only if both allow it, and
+// neither is charged otherwise. weight sets the tenant's share relative to
+// the other active tenants; the total weight is recomputed on every call, so
+// shares grow as tenants go quiet. Overrides do not apply. Observers, the
+// logger and hot key tracking see decisions under fs.Key and fs.Limit.
+func (l Limiter) AllowFair(fs FairShare, tenant string, weight float64, n int64) (*FairShareResult, error) {
+	return l.AllowFairContext(context.Background(), fs, tenant, weight, n)
+}
+
+// AllowFairContext is like AllowFair, tracing the call as a child of ctx.
+func (l Limiter) AllowFairContext(ctx context.Context, fs FairShare, tenant string, weight float64, n int64) (*FairShareResult, error) {
+	ctx, span := l.tracer.Start(ctx, "gcra.AllowFair", trace.WithAttributes(keyHashAttr(fs.Key), attrCost.Int64(n)))
+	defer span.End()
+
+	res, err := l.allowFair(ctx, fs, tenant, weight, n)
+	if err != nil {
+		spanError(span, err)
+		l.report(ctx, fs.Key, fs.Limit, n, nil, err)
+		return nil, err
+	}
+	endAllowSpan(span, &res.RateLimitResult, nil)
+	l.report(ctx, fs.Key, fs.Limit, n, &res.RateLimitResult, nil)
+	return res, nil
+}
+
+func (l Limiter) allowFair(ctx context.Context, fs FairShare, tenant string, weight float64, n int64) (*FairShareResult, error) {
+	if err := fs.Limit.validate(); err != nil {
+		return nil, err
+	}
+	if fs.Limit.Algorithm.windowed() {
+		return nil, &LimitError{Limit: fs.Limit, Field: "Algorithm", Msg: "is not supported for fair sharing"}
+	}
+	if fs.Limit.Overdraft > 0 {
+		return nil, &LimitError{Limit: fs.Limit, Field: "Overdraft", Msg: "is not supported for fair sharing"}
+	}
+	if tenant == "" {
+		return nil, fmt.Errorf("%w: empty tenant", ErrInvalidLimit)
+	}
+	if weight <= 0 {
+		return nil, fmt.Errorf("%w: tenant weight must be greater than zero", ErrInvalidLimit)
+	}
+	window := fs.Window
+	if window <= 0 {
+		window = defaultFairShareWindow
+	}
+
+	base := redisPrefix + fs.Key
+	keys := []string{base, base + ":tenant:" + tenant, base + ":active", base + ":weights", base + ":weight_total"}
+	name := fs.Limit.String()
+	var resp []interface{}
+	err := l.evalScript(ctx, &resp, fairShareScriptSrc, keys,
+		strconv.FormatInt(n, 10),
+		strconv.FormatInt(fs.Limit.Burst, 10),
+		strconv.FormatInt(fs.Limit.Rate, 10),
+		strconv.FormatFloat(fs.Limit.Period.Seconds(), 'f', -1, 64),
+		tenant,
+		strconv.FormatFloat(weight, 'f', -1, 64),
+		strconv.FormatFloat(window.Seconds(), 'f', -1, 64),
+	)
+	if err != nil {
+		res, err := l.degrade(ctx, name, fs.Key, fs.Limit, n, err)
+		if err != nil {
+			return nil, err
+		}
+		return &FairShareResult{RateLimitResult: *res}, nil
+	}
+	if len(resp) != 12 {
+		return nil, fmt.Errorf("%w: got %d items, want 12", ErrUnexpectedResponse, len(resp))
+	}
+
+	levels := make([]RateLimitResult, 2)
+	denied := false
+	for i := range levels {
+		res, err := parseResult(fs.Limit, resp[5*i:5*i+5])
+		if err != nil {
+			return nil, err
+		}
+		levels[i] = *res
+		if res.Reason != ReasonAllowed {
+			denied = true
+		}
+	}
+	share, err := strconv.ParseFloat(fmt.Sprint(resp[10]), 64)
+	if err != nil {
+		return nil, responseErr("parse share", err)
+	}
+	active, err := strconv.ParseInt(fmt.Sprint(resp[11]), 10, 64)
+	if err != nil {
+		return nil, responseErr("parse active", err)
+	}
+
+	b := bottleneck(levels, denied)
+	out := &FairShareResult{RateLimitResult: levels[b], Share: share, Active: active, Global: b == 0}
+	if !denied {
+		out.Allowed = n
+	}
+	l.rec.RecordDecision(name, fs.Limit, n, !denied)
+	return out, nil
+}
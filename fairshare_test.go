@@ -0,0 +1,115 @@
+package leakybucketgcra_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestAllowFair(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	fs := gcra.FairShare{Key: "upstream", Limit: gcra.PerSecond(10, 10)}
+
+	// Alone, a tenant has the whole limit.
+	res, err := limiter.AllowFair(fs, "acme", 1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), res.Allowed)
+	assert.Equal(t, 1.0, res.Share)
+	assert.Equal(t, int64(1), res.Active)
+
+	// A second tenant of equal weight gets half.
+	res, err = limiter.AllowFair(fs, "globex", 1, 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.Allowed)
+	assert.Equal(t, 0.5, res.Share)
+	assert.Equal(t, int64(2), res.Active)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.False(t, res.Global)
+
+	res, err = limiter.AllowFair(fs, "globex", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.False(t, res.Global, "globex exceeded its share")
+	assert.InDelta(t, 200*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+
+	// Acme still has room in its share, but the global bucket is empty.
+	res, err = limiter.AllowFair(fs, "acme", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.True(t, res.Global)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	res, err = limiter.AllowFair(fs, "acme", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.True(t, res.Global)
+	assert.Equal(t, fs.Limit, res.Limit)
+	assert.InDelta(t, 100*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+}
+
+func TestAllowFairWeights(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	fs := gcra.FairShare{Key: "upstream", Limit: gcra.PerSecond(100, 100), Window: 5 * time.Second}
+
+	limiter.AllowFair(fs, "free", 1, 1)
+	res, err := limiter.AllowFair(fs, "paid", 3, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0.75, res.Share)
+
+	// Once the free tenant goes quiet, the paid one has the whole limit.
+	clock.Advance(3 * time.Second)
+	limiter.AllowFair(fs, "paid", 3, 1)
+	clock.Advance(3 * time.Second)
+	res, err = limiter.AllowFair(fs, "paid", 3, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, res.Share)
+	assert.Equal(t, int64(1), res.Active)
+}
+
+func TestAllowFairReachesObservers(t *testing.T) {
+	var allowed []int64
+	audit := gcra.ObserverFunc(func(_ context.Context, key string, limit gcra.Limit, _ int64, res *gcra.RateLimitResult, err error) {
+		require.NoError(t, err)
+		assert.Equal(t, "upstream", key)
+		assert.Equal(t, gcra.PerSecond(10, 10), limit)
+		allowed = append(allowed, res.Allowed)
+	})
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now),
+		gcra.WithObserver(audit), gcra.WithHotKeys(gcra.HotKeyOptions{}))
+	fs := gcra.FairShare{Key: "upstream", Limit: gcra.PerSecond(10, 10)}
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.AllowFair(fs, "acme", 1, 10)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []int64{10, 0}, allowed)
+	report := limiter.HotKeys()
+	require.Len(t, report.ByDenials, 1)
+	assert.Equal(t, "upstream", report.ByDenials[0].Key)
+}
+
+func TestAllowFairRejectsInvalidInput(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	fs := gcra.FairShare{Key: "upstream", Limit: gcra.PerSecond(10, 10)}
+
+	_, err := limiter.AllowFair(fs, "", 1, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowFair(fs, "acme", 0, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowFair(gcra.FairShare{Key: "upstream"}, "acme", 1, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	fs.Limit.Algorithm = gcra.AlgorithmFixedWindow
+	fs.Limit.Burst = 0
+	_, err = limiter.AllowFair(fs, "acme", 1, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
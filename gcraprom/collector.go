@@ -0,0 +1,183 @@
+// Package gcraprom exports limiter metrics to Prometheus. It lives in its own
+// module so the core limiter does not depend on the Prometheus client.
+//
+//	collector := gcraprom.NewCollector(client)
+//	prometheus.MustRegister(collector)
+//	limiter := gcra.NewLimiter(client, gcra.WithRecorder(collector))
+package gcraprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+// Option configures a Collector.
+type Option func(*config)
+
+type config struct {
+	namespace     string
+	costBuckets   []float64
+	scriptBuckets []float64
+}
+
+// WithNamespace sets the metric namespace. Defaults to "gcra".
+func WithNamespace(ns string) Option {
+	return func(c *config) {
+		c.namespace = ns
+	}
+}
+
+// WithCostBuckets sets the histogram buckets for request cost.
+func WithCostBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.costBuckets = buckets
+	}
+}
+
+// WithScriptBuckets sets the histogram buckets, in seconds, for Lua script latency.
+func WithScriptBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.scriptBuckets = buckets
+	}
+}
+
+// Collector is a prometheus.Collector and a gcra.Recorder. Register it with a
+// Prometheus registry and pass it to gcra.WithRecorder.
+type Collector struct {
+	allowed     *prometheus.CounterVec
+	denied      *prometheus.CounterVec
+	cost        *prometheus.HistogramVec
+	script      prometheus.Histogram
+	errors      *prometheus.CounterVec
+	degraded    *prometheus.CounterVec
+	denyHits    *prometheus.CounterVec
+	activeConns prometheus.GaugeFunc
+}
+
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ gcra.Recorder        = (*Collector)(nil)
+)
+
+// NewCollector returns a Collector. client is sampled at scrape time for
+// connection pool gauges; it may be nil.
+func NewCollector(client gcra.Client, opts ...Option) *Collector {
+	cfg := config{
+		namespace:     "gcra",
+		costBuckets:   []float64{1, 2, 5, 10, 25, 50, 100, 250, 1000},
+		scriptBuckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	c := &Collector{
+		allowed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "allowed_total",
+			Help:      "Number of requests allowed by the limiter.",
+		}, []string{"limit"}),
+		denied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "denied_total",
+			Help:      "Number of requests denied by the limiter.",
+		}, []string{"limit"}),
+		cost: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "request_cost",
+			Help:      "Cost of requests checked against the limiter.",
+			Buckets:   cfg.costBuckets,
+		}, []string{"limit"}),
+		script: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "script_duration_seconds",
+			Help:      "Latency of limiter Lua script executions.",
+			Buckets:   cfg.scriptBuckets,
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "redis_errors_total",
+			Help:      "Number of failed Redis calls.",
+		}, []string{"command"}),
+		degraded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "degraded_total",
+			Help:      "Number of requests allowed in fail-open mode without a Redis decision.",
+		}, []string{"limit"}),
+		denyHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "deny_cache_hits_total",
+			Help:      "Number of requests denied from the local deny cache without a Redis call.",
+		}, []string{"limit"}),
+	}
+	c.activeConns = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: cfg.namespace,
+		Name:      "pool_active_connections",
+		Help:      "Number of Redis connections in use, or -1 if unknown.",
+	}, func() float64 {
+		if client == nil {
+			return -1
+		}
+		return float64(client.NumActiveConns())
+	})
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.allowed.Describe(ch)
+	c.denied.Describe(ch)
+	c.cost.Describe(ch)
+	c.script.Describe(ch)
+	c.errors.Describe(ch)
+	c.degraded.Describe(ch)
+	c.denyHits.Describe(ch)
+	c.activeConns.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.allowed.Collect(ch)
+	c.denied.Collect(ch)
+	c.cost.Collect(ch)
+	c.script.Collect(ch)
+	c.errors.Collect(ch)
+	c.degraded.Collect(ch)
+	c.denyHits.Collect(ch)
+	c.activeConns.Collect(ch)
+}
+
+// RecordDecision implements gcra.Recorder.
+func (c *Collector) RecordDecision(name string, limit gcra.Limit, cost int64, allowed bool) {
+	if allowed {
+		c.allowed.WithLabelValues(name).Inc()
+	} else {
+		c.denied.WithLabelValues(name).Inc()
+	}
+	c.cost.WithLabelValues(name).Observe(float64(cost))
+}
+
+// RecordScript implements gcra.Recorder.
+func (c *Collector) RecordScript(elapsed time.Duration, err error) {
+	c.script.Observe(elapsed.Seconds())
+	if err != nil {
+		c.errors.WithLabelValues("EVALSHA").Inc()
+	}
+}
+
+// RecordError implements gcra.Recorder.
+func (c *Collector) RecordError(command string, err error) {
+	c.errors.WithLabelValues(command).Inc()
+}
+
+// RecordDegraded implements gcra.Recorder.
+func (c *Collector) RecordDegraded(name string) {
+	c.degraded.WithLabelValues(name).Inc()
+}
+
+// RecordDenyCacheHit implements gcra.Recorder.
+func (c *Collector) RecordDenyCacheHit(name string) {
+	c.denyHits.WithLabelValues(name).Inc()
+}
@@ -0,0 +1,58 @@
+package gcraprom_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	"github.com/sagarsuperuser/leaky-bucket-gcra/gcraprom"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestCollectorRecordsDecisions(t *testing.T) {
+	client := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	collector := gcraprom.NewCollector(client)
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(collector))
+
+	limiter := gcra.NewLimiter(client,
+		gcra.WithRecorder(collector),
+		gcra.WithLimitProvider(gcra.StaticLimits{"api": gcra.PerSecond(2, 2)}),
+	)
+	for i := 0; i < 3; i++ {
+		_, err := limiter.AllowNamed("user:1", "api")
+		require.NoError(t, err)
+	}
+	_, err := limiter.Allow("user:2", gcra.PerMinute(1, 1))
+	require.NoError(t, err)
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, lp := range m.GetLabel() {
+				name += "/" + lp.GetValue()
+			}
+			switch {
+			case m.Counter != nil:
+				values[name] = m.Counter.GetValue()
+			case m.Gauge != nil:
+				values[name] = m.Gauge.GetValue()
+			case m.Histogram != nil:
+				values[name] = float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	assert.Equal(t, 2.0, values["gcra_allowed_total/api"])
+	assert.Equal(t, 1.0, values["gcra_denied_total/api"])
+	assert.Equal(t, 1.0, values["gcra_allowed_total/1 req/m (burst 1)"])
+	assert.Equal(t, 3.0, values["gcra_request_cost/api"])
+	assert.Equal(t, 4.0, values["gcra_script_duration_seconds"])
+	assert.Equal(t, 0.0, values["gcra_pool_active_connections"])
+}
@@ -0,0 +1,151 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Node is one level of a hierarchy of limits, such as a tenant, one of its
+// users or one of the user's API keys.
+type Node struct {
+	Key   string
+	Limit Limit
+}
+
+// HierarchyResult reports a decision across a hierarchy of limits. The
+// embedded RateLimitResult is the combined decision; its fields are those of
+// the bottleneck level, except that Allowed applies to the whole request.
+type HierarchyResult struct {
+	RateLimitResult
+
+	// Levels holds the decision of each level, in the order given. When the
+	// request is denied, levels that had room report Allowed 0 and their
+	// state before the request.
+	Levels []RateLimitResult
+
+	// Bottleneck is the index of the level that limited the request: the
+	// denying level with the longest RetryAfter, or, when the request was
+	// allowed, the level with the least remaining.
+	Bottleneck int
+}
+
+// AllowHierarchy charges n tokens to every level of path atomically, in a
+// single script call: the request is allowed only if every level allows it,
+// and no level is charged otherwise. A typical path is tenant, user, API key,
+// so that a user's requests count against both their own bucket and their
+// organisation's shared one. Only GCRA limits without an overdraft are
+// supported, and overrides do not apply. Decisions are reported to the
+// Recorder under the leaf level's Limit.String, whichever level denied, and
+// to observers, the logger and hot key tracking under the leaf's Key and
+// Limit with the combined result.
+func (l Limiter) AllowHierarchy(path []Node, n int64) (*HierarchyResult, error) {
+	return l.AllowHierarchyContext(context.Background(), path, n)
+}
+
+// AllowHierarchyContext is like AllowHierarchy, tracing the call as a child
+// of ctx.
+func (l Limiter) AllowHierarchyContext(ctx context.Context, path []Node, n int64) (*HierarchyResult, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: empty hierarchy", ErrInvalidLimit)
+	}
+	leaf := path[len(path)-1]
+	ctx, span := l.tracer.Start(ctx, "gcra.AllowHierarchy", trace.WithAttributes(keyHashAttr(leaf.Key), attrCost.Int64(n)))
+	defer span.End()
+
+	res, err := l.allowHierarchy(ctx, path, n)
+	if err != nil {
+		spanError(span, err)
+		l.report(ctx, leaf.Key, leaf.Limit, n, nil, err)
+		return nil, err
+	}
+	endAllowSpan(span, &res.RateLimitResult, nil)
+	l.report(ctx, leaf.Key, leaf.Limit, n, &res.RateLimitResult, nil)
+	return res, nil
+}
+
+func (l Limiter) allowHierarchy(ctx context.Context, path []Node, n int64) (*HierarchyResult, error) {
+	keys := make([]string, len(path))
+	args := []interface{}{strconv.FormatInt(n, 10)}
+	for i, node := range path {
+		if err := node.Limit.validate(); err != nil {
+			return nil, fmt.Errorf("level %d (%s): %w", i, node.Key, err)
+		}
+		if node.Limit.Algorithm.windowed() {
+			return nil, fmt.Errorf("level %d (%s): %w", i, node.Key,
+				&LimitError{Limit: node.Limit, Field: "Algorithm", Msg: "is not supported in hierarchies"})
+		}
+		if node.Limit.Overdraft > 0 {
+			return nil, fmt.Errorf("level %d (%s): %w", i, node.Key,
+				&LimitError{Limit: node.Limit, Field: "Overdraft", Msg: "is not supported in hierarchies"})
+		}
+		keys[i] = redisPrefix + node.Key
+		args = append(args,
+			strconv.FormatInt(node.Limit.Burst, 10),
+			strconv.FormatInt(node.Limit.Rate, 10),
+			strconv.FormatFloat(node.Limit.Period.Seconds(), 'f', -1, 64),
+		)
+	}
+
+	leaf := path[len(path)-1]
+	name := leaf.Limit.String()
+	var resp []interface{}
+	if err := l.evalScript(ctx, &resp, allowHierarchyScriptSrc, keys, args...); err != nil {
+		res, err := l.degrade(ctx, name, leaf.Key, leaf.Limit, n, err)
+		if err != nil {
+			return nil, err
+		}
+		out := &HierarchyResult{RateLimitResult: *res, Levels: make([]RateLimitResult, len(path)), Bottleneck: len(path) - 1}
+		for i, node := range path {
+			out.Levels[i] = RateLimitResult{Limit: node.Limit, Allowed: n, Reason: ReasonDegraded}
+		}
+		return out, nil
+	}
+	if len(resp) != 5*len(path) {
+		return nil, fmt.Errorf("%w: got %d items, want %d", ErrUnexpectedResponse, len(resp), 5*len(path))
+	}
+
+	out := &HierarchyResult{Levels: make([]RateLimitResult, len(path))}
+	denied := false
+	for i, node := range path {
+		res, err := parseResult(node.Limit, resp[5*i:5*i+5])
+		if err != nil {
+			return nil, err
+		}
+		out.Levels[i] = *res
+		if res.Reason != ReasonAllowed {
+			denied = true
+		}
+	}
+	out.Bottleneck = bottleneck(out.Levels, denied)
+	out.RateLimitResult = out.Levels[out.Bottleneck]
+	if !denied {
+		out.Allowed = n
+	}
+	l.rec.RecordDecision(name, leaf.Limit, n, !denied)
+	return out, nil
+}
+
+// bottleneck picks the level that limited a request.
+func bottleneck(levels []RateLimitResult, denied bool) int {
+	best := -1
+	for i, res := range levels {
+		if denied {
+			switch {
+			case res.Reason == ReasonAllowed:
+				continue
+			case best < 0, res.Reason == ReasonCostExceedsBurst && levels[best].Reason != ReasonCostExceedsBurst:
+				best = i
+			case res.RetryAfter != nil && levels[best].RetryAfter != nil && *res.RetryAfter > *levels[best].RetryAfter:
+				best = i
+			}
+			continue
+		}
+		if best < 0 || res.Remaining < levels[best].Remaining {
+			best = i
+		}
+	}
+	return best
+}
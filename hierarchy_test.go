@@ -0,0 +1,123 @@
+package leakybucketgcra_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestAllowHierarchy(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	org := gcra.PerSecond(1, 3)
+	user := gcra.PerSecond(1, 2)
+	alice := []gcra.Node{{"org:acme", org}, {"user:alice", user}}
+	bob := []gcra.Node{{"org:acme", org}, {"user:bob", user}}
+
+	res, err := limiter.AllowHierarchy(alice, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, 1, res.Bottleneck, "alice has less room than the org")
+	assert.Equal(t, int64(1), res.Remaining)
+	assert.Equal(t, []int64{2, 1}, []int64{res.Levels[0].Remaining, res.Levels[1].Remaining})
+
+	res, err = limiter.AllowHierarchy(alice, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+
+	// Alice is exhausted; the org is not charged for her denied request.
+	res, err = limiter.AllowHierarchy(alice, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 1, res.Bottleneck)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, user, res.Limit)
+	assert.Equal(t, gcra.ReasonAllowed, res.Levels[0].Reason)
+	assert.Equal(t, int64(0), res.Levels[0].Allowed)
+	assert.Equal(t, int64(1), res.Levels[0].Remaining)
+
+	// Bob has room of his own but the org has only one token left.
+	res, err = limiter.AllowHierarchy(bob, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, 0, res.Bottleneck)
+	res, err = limiter.AllowHierarchy(bob, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 0, res.Bottleneck)
+	assert.Equal(t, org, res.Limit)
+	assert.Equal(t, time.Second, *res.RetryAfter)
+}
+
+// decisionRecorder records the names of the decisions it sees and counts
+// failed scripts.
+type decisionRecorder struct {
+	names      []string
+	scriptErrs int
+}
+
+func (r *decisionRecorder) RecordDecision(name string, _ gcra.Limit, _ int64, _ bool) {
+	r.names = append(r.names, name)
+}
+func (r *decisionRecorder) RecordScript(_ time.Duration, err error) {
+	if err != nil {
+		r.scriptErrs++
+	}
+}
+func (r *decisionRecorder) RecordError(string, error) {}
+func (r *decisionRecorder) RecordDegraded(string)     {}
+func (r *decisionRecorder) RecordDenyCacheHit(string) {}
+
+func TestAllowHierarchyRecordsLeafName(t *testing.T) {
+	rec := &decisionRecorder{}
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))), gcra.WithRecorder(rec))
+	org := gcra.PerSecond(1, 1)
+	user := gcra.PerSecond(1, 2)
+	path := []gcra.Node{{"org:acme", org}, {"user:alice", user}}
+
+	// The org is the bottleneck of both requests.
+	for i := 0; i < 2; i++ {
+		_, err := limiter.AllowHierarchy(path, 1)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{user.String(), user.String()}, rec.names)
+}
+
+func TestAllowHierarchyReachesObservers(t *testing.T) {
+	var seen []string
+	audit := gcra.ObserverFunc(func(_ context.Context, key string, limit gcra.Limit, _ int64, res *gcra.RateLimitResult, err error) {
+		require.NoError(t, err)
+		seen = append(seen, fmt.Sprintf("%s %s %d", key, limit, res.Allowed))
+	})
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now),
+		gcra.WithObserver(audit), gcra.WithHotKeys(gcra.HotKeyOptions{}))
+	user := gcra.PerSecond(1, 2)
+	path := []gcra.Node{{"org:acme", gcra.PerSecond(1, 1)}, {"user:alice", user}}
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.AllowHierarchy(path, 1)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"user:alice " + user.String() + " 1", "user:alice " + user.String() + " 0"}, seen)
+	report := limiter.HotKeys()
+	require.Len(t, report.ByDenials, 1)
+	assert.Equal(t, "user:alice", report.ByDenials[0].Key)
+}
+
+func TestAllowHierarchyRejectsInvalidPaths(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	_, err := limiter.AllowHierarchy(nil, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowHierarchy([]gcra.Node{{"org:acme", gcra.PerSecond(1, 1)}, {"user:alice", gcra.Limit{}}}, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowHierarchy([]gcra.Node{{"org:acme", gcra.Limit{Rate: 1, Period: time.Hour, Algorithm: gcra.AlgorithmFixedWindow}}}, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
@@ -0,0 +1,195 @@
+package leakybucketgcra
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHotKeysN      = 10
+	defaultHotKeysWindow = time.Minute
+
+	// hotKeysSlack is how many more keys are tracked than reported; more
+	// slack makes the top N more accurate.
+	hotKeysSlack = 4
+
+	// hotKeysRescale bounds the exponent of event weights before counts are
+	// renormalized.
+	hotKeysRescale = 50
+)
+
+// HotKeyOptions configures hot key detection.
+type HotKeyOptions struct {
+	// N is how many keys each list reports. Defaults to 10.
+	N int
+
+	// Window is the averaging time of the reported rates: the weight of a
+	// request decays by 1/e every Window. Defaults to one minute.
+	Window time.Duration
+
+	// SampleRate is the fraction of requests counted, between 0 and 1.
+	// Sampling lowers the overhead on busy limiters at some cost in
+	// accuracy. Defaults to 1.
+	SampleRate float64
+}
+
+// HotKey is a key with its estimated request or denial rate.
+type HotKey struct {
+	Key string
+
+	// Rate is the estimated number of events per second, averaged over
+	// HotKeyOptions.Window. It may be overestimated by up to Error.
+	Rate  float64
+	Error float64
+}
+
+// HotKeyReport lists the busiest keys seen by a Limiter.
+type HotKeyReport struct {
+	ByRequests []HotKey // most requested keys first
+	ByDenials  []HotKey // most denied keys first
+}
+
+// WithHotKeys makes the Limiter track its most requested and most denied keys
+// in bounded memory, reported by HotKeys. Keys are counted with the
+// space-saving algorithm, so a key's rate may be overestimated but a key
+// busier than the reported ones is never missed for lack of space.
+func WithHotKeys(opts HotKeyOptions) Option {
+	return func(l *Limiter) {
+		if opts.N <= 0 {
+			opts.N = defaultHotKeysN
+		}
+		if opts.Window <= 0 {
+			opts.Window = defaultHotKeysWindow
+		}
+		if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+			opts.SampleRate = 1
+		}
+		l.hotKeys = &hotKeys{
+			opts:     opts,
+			requests: newSpaceSaving(opts.N * hotKeysSlack),
+			denials:  newSpaceSaving(opts.N * hotKeysSlack),
+		}
+	}
+}
+
+// HotKeys reports the keys with the highest request and denial rates. The
+// report is empty unless the Limiter was configured with WithHotKeys.
+func (l Limiter) HotKeys() HotKeyReport {
+	if l.hotKeys == nil {
+		return HotKeyReport{}
+	}
+	return l.hotKeys.report(l.now())
+}
+
+// hotKeys counts requests with exponentially decaying weights. Rather than
+// decaying every counter as time passes, the weight of each new event grows
+// as exp((now-epoch)/window), and counts are scaled back down when reported.
+type hotKeys struct {
+	opts HotKeyOptions
+
+	mu       sync.Mutex
+	epoch    time.Time
+	requests *spaceSaving
+	denials  *spaceSaving
+}
+
+func (h *hotKeys) record(key string, denied bool, now time.Time) {
+	if h.opts.SampleRate < 1 && rand.Float64() >= h.opts.SampleRate {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.epoch.IsZero() {
+		h.epoch = now
+	}
+	exp := now.Sub(h.epoch).Seconds() / h.opts.Window.Seconds()
+	if exp > hotKeysRescale {
+		f := math.Exp(-exp)
+		h.requests.scale(f)
+		h.denials.scale(f)
+		h.epoch, exp = now, 0
+	}
+	w := math.Exp(exp) / h.opts.SampleRate
+	h.requests.add(key, w)
+	if denied {
+		h.denials.add(key, w)
+	}
+}
+
+func (h *hotKeys) report(now time.Time) HotKeyReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// A steady rate r accumulates a decayed count of r*window.
+	f := math.Exp(-now.Sub(h.epoch).Seconds()/h.opts.Window.Seconds()) / h.opts.Window.Seconds()
+	return HotKeyReport{
+		ByRequests: h.requests.top(h.opts.N, f),
+		ByDenials:  h.denials.top(h.opts.N, f),
+	}
+}
+
+// spaceSaving keeps approximate counts for the heaviest keys in a stream
+// using a fixed number of counters (Metwally et al., 2005).
+type spaceSaving struct {
+	size     int
+	counters map[string]*hotCounter
+}
+
+type hotCounter struct {
+	key   string
+	count float64
+	err   float64 // count inherited from the evicted key
+}
+
+func newSpaceSaving(size int) *spaceSaving {
+	return &spaceSaving{size: size, counters: make(map[string]*hotCounter, size)}
+}
+
+func (s *spaceSaving) add(key string, w float64) {
+	if c, ok := s.counters[key]; ok {
+		c.count += w
+		return
+	}
+	if len(s.counters) < s.size {
+		s.counters[key] = &hotCounter{key: key, count: w}
+		return
+	}
+	var least *hotCounter
+	for _, c := range s.counters {
+		if least == nil || c.count < least.count {
+			least = c
+		}
+	}
+	delete(s.counters, least.key)
+	s.counters[key] = &hotCounter{key: key, count: least.count + w, err: least.count}
+}
+
+func (s *spaceSaving) scale(f float64) {
+	for _, c := range s.counters {
+		c.count *= f
+		c.err *= f
+	}
+}
+
+// top returns the n largest counts multiplied by f.
+func (s *spaceSaving) top(n int, f float64) []HotKey {
+	out := make([]HotKey, 0, len(s.counters))
+	for _, c := range s.counters {
+		out = append(out, HotKey{Key: c.key, Rate: c.count * f, Error: c.err * f})
+	}
+	slices.SortFunc(out, func(a, b HotKey) int {
+		if c := cmp.Compare(b.Rate, a.Rate); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
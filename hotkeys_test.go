@@ -0,0 +1,56 @@
+package leakybucketgcra_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestHotKeys(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now),
+		gcra.WithHotKeys(gcra.HotKeyOptions{N: 2, Window: time.Minute}))
+	limit := gcra.PerSecond(100, 100)
+
+	// Over a minute, "abuser" sends 50 req/s, "noisy" 5 req/s and "bad"
+	// 2 req/s that are all denied, alongside a stream of one-off keys.
+	for s := 0; s < 60; s++ {
+		for i := 0; i < 50; i++ {
+			limiter.Allow("abuser", limit)
+		}
+		for i := 0; i < 5; i++ {
+			limiter.Allow("noisy", limit)
+		}
+		for i := 0; i < 2; i++ {
+			limiter.Allow("bad", gcra.PerHour(1, 0))
+		}
+		limiter.Allow(fmt.Sprintf("quiet:%d", s), limit)
+		clock.Advance(time.Second)
+	}
+
+	report := limiter.HotKeys()
+	require.Len(t, report.ByRequests, 2)
+	assert.Equal(t, "abuser", report.ByRequests[0].Key)
+	assert.Equal(t, "noisy", report.ByRequests[1].Key)
+	// A minute of steady traffic with a one minute window reaches 1-1/e of
+	// the true rate.
+	assert.InDelta(t, 50*(1-1/2.718281828), report.ByRequests[0].Rate, 1.5)
+
+	require.Len(t, report.ByDenials, 1)
+	assert.Equal(t, "bad", report.ByDenials[0].Key)
+
+	// Rates decay once traffic stops.
+	clock.Advance(10 * time.Minute)
+	assert.Less(t, limiter.HotKeys().ByRequests[0].Rate, 0.01)
+}
+
+func TestHotKeysDisabled(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	assert.Empty(t, limiter.HotKeys().ByRequests)
+}
@@ -0,0 +1,274 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLeaseSize         = 10
+	defaultLeaseMaxStaleness = 100 * time.Millisecond
+)
+
+// LeaseOptions configures local token leasing.
+type LeaseOptions struct {
+	// Size is how many tokens are reserved from Redis at once. Fewer are
+	// reserved when the bucket holds less, and more when a single request
+	// costs more. Defaults to 10.
+	Size int64
+
+	// MaxStaleness is how long a lease may be spent locally. Unused tokens
+	// are then given back to the bucket. Defaults to 100ms.
+	MaxStaleness time.Duration
+
+	// Keys selects the keys to lease. Defaults to every key.
+	Keys func(key string) bool
+}
+
+// WithLeasing makes the Limiter reserve blocks of tokens from the Redis bucket
+// and spend them in process, so that only one request in opts.Size needs a
+// round trip. This trades precision for throughput on very hot keys: tokens
+// leased by one process are unavailable to others until spent or returned,
+// and Remaining is the bucket's level when the lease was taken, less local
+// spending. Close returns every outstanding lease; afterwards requests are
+// no longer leased.
+func WithLeasing(opts LeaseOptions) Option {
+	return func(l *Limiter) {
+		if opts.Size <= 0 {
+			opts.Size = defaultLeaseSize
+		}
+		if opts.MaxStaleness <= 0 {
+			opts.MaxStaleness = defaultLeaseMaxStaleness
+		}
+		if opts.Keys == nil {
+			opts.Keys = func(string) bool { return true }
+		}
+		s := &leaseStore{
+			opts:   opts,
+			leases: make(map[string]*lease),
+			stop:   make(chan struct{}),
+			done:   make(chan struct{}),
+		}
+		l.leases = s
+		l.closers = append(l.closers, s.close)
+	}
+}
+
+// lease is a block of tokens reserved for one key.
+type lease struct {
+	mu        sync.Mutex // held while refilling, so one caller per key goes to Redis
+	limit     Limit
+	tokens    int64
+	remaining int64 // bucket level when the lease was taken
+	expires   time.Time
+	dropped   bool // removed from the store; acquire a fresh lease
+}
+
+type leaseStore struct {
+	opts LeaseOptions
+
+	mu     sync.Mutex // guards the fields below
+	leases map[string]*lease
+	closed bool // no more leases are taken
+
+	// The sweeper starts with the first lease and returns expired leases
+	// through the Limiter that took it.
+	started bool
+	limiter Limiter
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// acquire returns the lease for key, locked, starting the sweeper with the
+// first lease. It returns nil once the store is closed.
+func (s *leaseStore) acquire(l Limiter, key string) *lease {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil
+		}
+		if !s.started {
+			s.started = true
+			s.limiter = l
+			go s.sweep()
+		}
+		le, ok := s.leases[key]
+		if !ok {
+			le = &lease{}
+			s.leases[key] = le
+		}
+		s.mu.Unlock()
+
+		le.mu.Lock()
+		if !le.dropped {
+			return le
+		}
+		le.mu.Unlock()
+	}
+}
+
+// remove deletes le from the store. The caller holds le.mu.
+func (s *leaseStore) remove(key string, le *lease) {
+	le.dropped = true
+	s.mu.Lock()
+	if s.leases[key] == le {
+		delete(s.leases, key)
+	}
+	s.mu.Unlock()
+}
+
+// drop forgets the lease for key without returning its tokens.
+func (s *leaseStore) drop(key string) {
+	s.mu.Lock()
+	le, ok := s.leases[key]
+	s.mu.Unlock()
+	if ok {
+		le.mu.Lock()
+		s.remove(key, le)
+		le.mu.Unlock()
+	}
+}
+
+// allowLeased spends n tokens from the lease for key, taking a new lease
+// when the current one is exhausted, expired or for another limit.
+func (l Limiter) allowLeased(ctx context.Context, key string, limit Limit, n int64) (*RateLimitResult, error) {
+	s := l.leases
+	le := s.acquire(l, key)
+	if le == nil {
+		// Closed: every request goes to Redis.
+		return l.runAllow(ctx, key, limit, n, 0, false)
+	}
+	defer le.mu.Unlock()
+
+	now := l.now()
+	if le.limit == limit && now.Before(le.expires) && le.tokens >= n {
+		le.tokens -= n
+		return &RateLimitResult{
+			Limit:     limit,
+			Allowed:   n,
+			Remaining: le.remaining + le.tokens,
+			Reason:    ReasonAllowed,
+		}, nil
+	}
+	if le.tokens > 0 {
+		// Best effort: tokens that cannot be returned are spent.
+		l.returnTokens(ctx, key, le.limit, le.tokens)
+		le.tokens = 0
+	}
+
+	res, err := l.runLease(ctx, key, limit, n, max(s.opts.Size, n))
+	if err != nil {
+		return nil, err
+	}
+	if res.Allowed > 0 {
+		le.limit = limit
+		le.tokens = res.Allowed - n
+		le.remaining = res.Remaining
+		le.expires = now.Add(s.opts.MaxStaleness)
+		res.Allowed = n
+		res.Remaining += le.tokens
+	}
+	return res, nil
+}
+
+func (l Limiter) runLease(ctx context.Context, key string, limit Limit, minCost, maxCost int64) (*RateLimitResult, error) {
+	var resp []interface{}
+	err := l.evalScript(
+		ctx,
+		&resp,
+		leaseScriptSrc,
+		[]string{redisPrefix + key},
+		strconv.FormatInt(limit.Burst, 10),
+		strconv.FormatInt(limit.Rate, 10),
+		strconv.FormatFloat(limit.Period.Seconds(), 'f', -1, 64),
+		strconv.FormatInt(minCost, 10),
+		strconv.FormatInt(maxCost, 10),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(limit, resp)
+}
+
+// returnTokens gives unused tokens back to the bucket for key.
+func (l Limiter) returnTokens(ctx context.Context, key string, limit Limit, tokens int64) error {
+	var resp []interface{}
+	err := l.evalScript(
+		ctx,
+		&resp,
+		returnTokensScriptSrc,
+		[]string{redisPrefix + key},
+		strconv.FormatInt(limit.Rate, 10),
+		strconv.FormatFloat(limit.Period.Seconds(), 'f', -1, 64),
+		strconv.FormatInt(tokens, 10),
+	)
+	if err != nil {
+		l.log.backendError(ctx, "return_tokens", key, &limit, err, false)
+	}
+	return err
+}
+
+func (s *leaseStore) sweep() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.MaxStaleness)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.release(false)
+		}
+	}
+}
+
+// release returns the unused tokens of expired leases, or of all leases
+// when all is set, and forgets them.
+func (s *leaseStore) release(all bool) error {
+	s.mu.Lock()
+	leases := make(map[string]*lease, len(s.leases))
+	for key, le := range s.leases {
+		leases[key] = le
+	}
+	s.mu.Unlock()
+
+	l := s.limiter
+	now := l.now()
+	var errs []error
+	for key, le := range leases {
+		le.mu.Lock()
+		if !le.dropped && (all || !now.Before(le.expires)) {
+			if le.tokens > 0 {
+				if err := l.returnTokens(context.Background(), key, le.limit, le.tokens); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			s.remove(key, le)
+		}
+		le.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// close refuses new leases, stops the sweeper and returns every outstanding
+// lease.
+func (s *leaseStore) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	started := s.started
+	s.mu.Unlock()
+	if !started {
+		return nil
+	}
+	close(s.stop)
+	<-s.done
+	return s.release(true)
+}
@@ -0,0 +1,101 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestLeasing(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithClock(clock.Now),
+		gcra.WithLeasing(gcra.LeaseOptions{Size: 5, MaxStaleness: time.Hour}))
+	defer limiter.Close()
+	limit := gcra.PerSecond(10, 20)
+
+	for i := 0; i < 5; i++ {
+		res, err := limiter.Allow("partner", limit)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), res.Allowed)
+		assert.Equal(t, int64(19-i), res.Remaining)
+	}
+	assert.Equal(t, 1, rdb.evals)
+
+	// A request costing more than the lease holds takes a new lease.
+	res, err := limiter.AllowN("partner", limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, 2, rdb.evals)
+
+	// The bucket never grants more than it holds across leases.
+	allowed := int64(8)
+	for i := 0; i < 20; i++ {
+		res, err := limiter.Allow("partner", limit)
+		require.NoError(t, err)
+		allowed += res.Allowed
+	}
+	assert.Equal(t, int64(20), allowed)
+}
+
+func TestLeasingReturnsUnusedTokens(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	limit := gcra.PerSecond(1, 10)
+
+	leasing := gcra.NewLimiter(mock, gcra.WithClock(clock.Now),
+		gcra.WithLeasing(gcra.LeaseOptions{Size: 10, MaxStaleness: time.Hour}))
+	_, err := leasing.Allow("partner", limit)
+	require.NoError(t, err)
+
+	plain := gcra.NewLimiter(mock)
+	res, err := plain.Allow("partner", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+
+	require.NoError(t, leasing.Close())
+	res, err = plain.AllowN("partner", limit, 9)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), res.Allowed)
+}
+
+func TestLeasingStopsAfterClose(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	limit := gcra.PerSecond(1, 10)
+
+	// Closing before any lease was taken still stops leasing for good.
+	leasing := gcra.NewLimiter(mock, gcra.WithClock(clock.Now),
+		gcra.WithLeasing(gcra.LeaseOptions{Size: 10, MaxStaleness: time.Hour}))
+	require.NoError(t, leasing.Close())
+	res, err := leasing.Allow("partner", limit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), res.Remaining)
+	require.NoError(t, leasing.Close())
+
+	res, err = gcra.NewLimiter(mock).AllowN("partner", limit, 9)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), res.Allowed)
+}
+
+func TestLeasingSelectedKeys(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithClock(clock.Now), gcra.WithLeasing(gcra.LeaseOptions{
+		MaxStaleness: time.Hour,
+		Keys:         func(key string) bool { return key == "hot" },
+	}))
+	defer limiter.Close()
+	limit := gcra.PerSecond(10, 20)
+
+	limiter.Allow("hot", limit)
+	limiter.Allow("hot", limit)
+	limiter.Allow("cold", limit)
+	limiter.Allow("cold", limit)
+	assert.Equal(t, 3, rdb.evals)
+}
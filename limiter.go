@@ -1,9 +1,18 @@
 package leakybucketgcra
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
 	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const redisPrefix = ""
@@ -16,9 +25,31 @@ type Limit struct {
 	Rate   int64         // allowed requests per period; must be > 0
 	Burst  int64         // maximum tokens allowed at once; must be >= 0
 	Period time.Duration // time window in which the rate no. of requests are allowed; must be > 0
+
+	// Algorithm selects how the limit is enforced; the zero value is GCRA.
+	// Windowed algorithms allow Rate requests per window; their Burst must
+	// be 0, as Limit.String does not record it.
+	Algorithm Algorithm
+
+	// Overdraft is how many tokens a request may borrow once the bucket is
+	// empty; must be >= 0. Borrowed tokens are repaid at Rate before the
+	// bucket refills, so later requests are delayed in proportion, and
+	// Remaining goes negative while in debt. Requests on the same key made
+	// with a Limit without Overdraft are denied until the debt is repaid.
+	// Only GCRA limits support an overdraft.
+	Overdraft int64
 }
 
+// String formats the limit as "10 req/s (burst 20)", "10 req/s (burst 20,
+// overdraft 5)", or "1000 req/h (fixed_window)" for windowed algorithms;
+// ParseLimit accepts the result.
 func (l Limit) String() string {
+	if l.Algorithm.windowed() {
+		return fmt.Sprintf("%d req/%s (%s)", l.Rate, fmtDur(l.Period), l.Algorithm)
+	}
+	if l.Overdraft > 0 {
+		return fmt.Sprintf("%d req/%s (burst %d, overdraft %d)", l.Rate, fmtDur(l.Period), l.Burst, l.Overdraft)
+	}
 	return fmt.Sprintf("%d req/%s (burst %d)", l.Rate, fmtDur(l.Period), l.Burst)
 }
 
@@ -26,6 +57,39 @@ func (l Limit) IsZero() bool {
 	return l == Limit{}
 }
 
+// validate reports a *LimitError if the limit can never be enforced.
+func (l Limit) validate() error {
+	if l.Burst < 0 {
+		return &LimitError{Limit: l, Field: "Burst", Msg: "must not be negative"}
+	}
+
+	if l.Period <= 0 {
+		return &LimitError{Limit: l, Field: "Period", Msg: "must be greater than zero"}
+	}
+
+	if l.Rate <= 0 {
+		return &LimitError{Limit: l, Field: "Rate", Msg: "must be greater than zero"}
+	}
+
+	if _, ok := algorithmNames[l.Algorithm]; !ok {
+		return &LimitError{Limit: l, Field: "Algorithm", Msg: "is not supported"}
+	}
+
+	if l.Overdraft < 0 {
+		return &LimitError{Limit: l, Field: "Overdraft", Msg: "must not be negative"}
+	}
+
+	if l.Overdraft > 0 && l.Algorithm.windowed() {
+		return &LimitError{Limit: l, Field: "Overdraft", Msg: "is only supported by GCRA limits"}
+	}
+
+	// Window algorithms have no burst, and Limit.String omits it.
+	if l.Burst > 0 && l.Algorithm.windowed() {
+		return &LimitError{Limit: l, Field: "Burst", Msg: "is only supported by GCRA limits"}
+	}
+	return nil
+}
+
 func fmtDur(d time.Duration) string {
 	switch d {
 	case time.Second:
@@ -34,6 +98,10 @@ func fmtDur(d time.Duration) string {
 		return "m"
 	case time.Hour:
 		return "h"
+	case 24 * time.Hour:
+		return "day"
+	case 7 * 24 * time.Hour:
+		return "week"
 	}
 	return d.String()
 }
@@ -78,16 +146,38 @@ type RateLimitResult struct {
 	// ResetAfter is the time until the limiter returns to a fully replenished state.
 	// After this duration, the next request can ask for the full Burst again.
 	ResetAfter *time.Duration
+
+	// Reason explains the decision, for example to tell a request that can
+	// never be allowed (ReasonCostExceedsBurst) from one that was throttled.
+	Reason Reason
 }
 
 // Limiter controls how frequently events are allowed to happen.
 type Limiter struct {
-	rdb Client
+	rdb       Client
+	limits    LimitProvider
+	overrides *overrideStore
+	rec       Recorder
+	tracer    trace.Tracer
+	observers []Observer
+	log       *limiterLog
+	denials   *denyCache
+	leases    *leaseStore
+	coalescer *coalescer
+	hotKeys   *hotKeys
+	reserves  PriorityReserves
+	now       func() time.Time
+	failOpen  bool
+	closers   []func() error
 }
 
-// NewLimiter returns a new Limiter.
-func NewLimiter(rdb Client) *Limiter {
-	return &Limiter{rdb: rdb}
+// NewLimiter returns a new Limiter configured with the given options.
+func NewLimiter(rdb Client, opts ...Option) *Limiter {
+	l := &Limiter{rdb: rdb, rec: nopRecorder{}, tracer: noop.NewTracerProvider().Tracer(""), now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Allow is a shortcut for AllowN with cost 1.
@@ -99,78 +189,256 @@ func (l Limiter) Allow(key string, limit Limit) (*RateLimitResult, error) {
 // It returns the absolute theoretical arrival time (TAT) as a duration offset
 // from the internal epoch used by the limiter. A nil result indicates no state exists.
 func (l Limiter) Peek(key string) (*time.Duration, error) {
+	return l.PeekContext(context.Background(), key)
+}
+
+// PeekContext is like Peek, tracing the call as a child of ctx.
+func (l Limiter) PeekContext(ctx context.Context, key string) (*time.Duration, error) {
+	_, span := l.tracer.Start(ctx, "gcra.Peek", trace.WithAttributes(keyHashAttr(key)))
+	defer span.End()
+
 	var raw interface{}
 	if err := l.rdb.DoCmd(&raw, "GET", redisPrefix+key); err != nil {
+		err = backendErr(err)
+		l.rec.RecordError("GET", err)
+		l.log.backendError(ctx, "peek", key, nil, err, false)
+		spanError(span, err)
 		return nil, err
 	}
 	dur, err := parseDurationSeconds(raw)
 	if err != nil {
+		err = responseErr("parse state", err)
+		spanError(span, err)
 		return nil, err
 	}
 	return dur, nil
 }
 
 // AllowN reports whether n events may happen at time now (cost = n).
+// When overrides are enabled, a stored override for the key's tenant
+// replaces limit.
 func (l Limiter) AllowN(key string, limit Limit, n int64) (*RateLimitResult, error) {
-	if limit.Burst < 0 {
-		return nil, fmt.Errorf("invalid Limit: %#v,  burst must be greater than zero", limit)
+	return l.allowN(context.Background(), "", key, limit, n, allowOpts{})
+}
+
+// AllowNContext is like AllowN, tracing the call as a child of ctx.
+func (l Limiter) AllowNContext(ctx context.Context, key string, limit Limit, n int64) (*RateLimitResult, error) {
+	return l.allowN(ctx, "", key, limit, n, allowOpts{})
+}
+
+// Reset removes any tracking for this key by deleting its Redis entries.
+func (l Limiter) Reset(key string) error {
+	return l.ResetContext(context.Background(), key)
+}
+
+// ResetContext is like Reset, tracing the call as a child of ctx.
+func (l Limiter) ResetContext(ctx context.Context, key string) error {
+	_, span := l.tracer.Start(ctx, "gcra.Reset", trace.WithAttributes(keyHashAttr(key)))
+	defer span.End()
+
+	if l.denials != nil {
+		l.denials.remove(key)
+	}
+	if l.leases != nil {
+		l.leases.drop(key)
+	}
+	var keys []interface{}
+	for _, a := range slices.Sorted(maps.Keys(windowScripts)) {
+		keys = append(keys, redisPrefix+key+windowScripts[a].suffix)
+	}
+	if err := l.rdb.DoCmd(nil, "DEL", redisPrefix+key, keys...); err != nil {
+		err = backendErr(err)
+		l.rec.RecordError("DEL", err)
+		l.log.backendError(ctx, "reset", key, nil, err, false)
+		spanError(span, err)
+		return err
+	}
+	return nil
+}
+
+// Close releases background resources held by the Limiter, such as
+// pub/sub subscriptions. It does not close the Client.
+func (l Limiter) Close() error {
+	var errs []error
+	for _, c := range l.closers {
+		if err := c(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
+}
+
+// Internal helpers -----------------------------------------------------------
+
+// allowOpts are per-call settings that are not part of the Limit.
+type allowOpts struct {
+	priority   Priority
+	startEmpty bool // a bucket seen for the first time starts empty
+}
 
-	if limit.Period <= 0 {
-		return nil, fmt.Errorf("invalid Limit: %#v,  period must be greater than zero", limit)
+// allowN implements AllowN; name labels the limit for the Recorder and
+// defaults to limit.String().
+func (l Limiter) allowN(ctx context.Context, name, key string, limit Limit, n int64, o allowOpts) (*RateLimitResult, error) {
+	if name == "" {
+		name = limit.String()
 	}
+	ctx, span := l.tracer.Start(ctx, "gcra.AllowN", trace.WithAttributes(keyHashAttr(key), attrCost.Int64(n)))
+	defer span.End()
+
+	res, err := l.decide(ctx, name, key, limit, n, o)
+	endAllowSpan(span, res, err)
+	l.report(ctx, key, limit, n, res, err)
+	return res, err
+}
 
-	if limit.Rate <= 0 {
-		return nil, fmt.Errorf("invalid Limit: %#v,  rate must be greater than zero", limit)
+// report passes a decision to the denial log, hot key tracking and
+// observers. A request of cost 0 is never a denial.
+func (l Limiter) report(ctx context.Context, key string, limit Limit, n int64, res *RateLimitResult, err error) {
+	denied := err == nil && res.Allowed < n
+	if denied {
+		l.log.denied(ctx, key, n, res)
 	}
+	if l.hotKeys != nil && err == nil {
+		l.hotKeys.record(key, denied, l.now())
+	}
+	l.notify(ctx, key, limit, n, res, err)
+}
 
-	res, err := l.runAllow(key, limit, n)
-	if err != nil {
+// decide applies overrides, validates the limit and runs the script.
+func (l Limiter) decide(ctx context.Context, name, key string, limit Limit, n int64, o allowOpts) (*RateLimitResult, error) {
+	overridden := false
+	if l.overrides != nil {
+		override, ok, err := l.overrides.lookup(key)
+		if errors.Is(err, ErrInvalidLimit) {
+			// A bad override is a configuration error, not an outage.
+			return nil, err
+		}
+		if err != nil {
+			l.rec.RecordError("HGET", err)
+			return l.degrade(ctx, name, key, limit, n, err)
+		}
+		if ok {
+			limit, overridden = override, true
+		}
+	}
+
+	if err := limit.validate(); err != nil {
 		return nil, err
 	}
+	reserve := l.reserves.tokens(limit, o.priority)
+
+	if l.denials != nil {
+		if res, ok := l.denials.lookup(key, limit, n, reserve, l.now()); ok {
+			l.rec.RecordDenyCacheHit(name)
+			l.rec.RecordDecision(name, limit, n, false)
+			return res, nil
+		}
+	}
+
+	var res *RateLimitResult
+	var err error
+	local := !limit.Algorithm.windowed() && reserve == 0 && limit.Overdraft == 0 && !o.startEmpty
+	if l.leases != nil && local && l.leases.opts.Keys(key) {
+		res, err = l.allowLeased(ctx, key, limit, n)
+	} else if l.coalescer != nil && local {
+		res, err = l.allowCoalesced(ctx, key, limit, n)
+	} else {
+		res, err = l.runAllow(ctx, key, limit, n, reserve, o.startEmpty)
+	}
+	if err != nil {
+		return l.degrade(ctx, name, key, limit, n, err)
+	}
+	if l.denials != nil {
+		l.denials.add(key, n, reserve, res, l.now())
+	}
+	if overridden && res.Reason == ReasonAllowed {
+		res.Reason = ReasonOverridden
+	}
+	l.rec.RecordDecision(name, limit, n, res.Allowed > 0)
 	return res, nil
 }
 
-// Reset removes any tracking for this key by deleting the Redis entry.
-func (l Limiter) Reset(key string) error {
-	return l.rdb.DoCmd(nil, "DEL", redisPrefix+key)
+// degrade returns err, or an allowing result when the Limiter fails open.
+func (l Limiter) degrade(ctx context.Context, name, key string, limit Limit, n int64, err error) (*RateLimitResult, error) {
+	l.log.backendError(ctx, "allow", key, &limit, err, l.failOpen)
+	if !l.failOpen {
+		return nil, err
+	}
+	l.rec.RecordDegraded(name)
+	return &RateLimitResult{Limit: limit, Allowed: n, Reason: ReasonDegraded}, nil
 }
 
-// Internal helpers -----------------------------------------------------------
-func (l Limiter) runAllow(key string, limit Limit, cost int64) (*RateLimitResult, error) {
+// evalScript runs a Lua script, reporting its latency to the Recorder and
+// tracing it as a child of ctx.
+func (l Limiter) evalScript(ctx context.Context, rcv interface{}, script string, keys []string, args ...interface{}) error {
+	_, span := l.tracer.Start(ctx, "gcra.EvalScript", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrDBSystem))
+	defer span.End()
+
+	start := time.Now()
+	err := backendErr(l.rdb.EvalScript(rcv, script, keys, args...))
+	l.rec.RecordScript(time.Since(start), err)
+	if err != nil {
+		spanError(span, err)
+	}
+	return err
+}
+
+// runAllow runs the script for limit's algorithm. For GCRA limits, reserve
+// tokens are kept back from the request, and startEmpty makes a new bucket
+// start empty rather than full.
+func (l Limiter) runAllow(ctx context.Context, key string, limit Limit, cost int64, reserve float64, startEmpty bool) (*RateLimitResult, error) {
 	var resp []interface{}
 
-	err := l.rdb.EvalScript(
-		&resp,
-		allowNScriptSrc,
-		[]string{redisPrefix + key},
+	script, keys := allowNScriptSrc, []string{redisPrefix + key}
+	args := []interface{}{
 		strconv.FormatInt(limit.Burst, 10),
 		strconv.FormatInt(limit.Rate, 10),
 		strconv.FormatFloat(limit.Period.Seconds(), 'f', -1, 64),
 		strconv.FormatInt(cost, 10),
-	)
-	if err != nil {
+	}
+	if ws, ok := windowScripts[limit.Algorithm]; ok {
+		script, keys = ws.src, []string{redisPrefix + key + ws.suffix}
+		args = append(args, strconv.FormatUint(rand.Uint64(), 36))
+	} else if reserve > 0 || limit.Overdraft > 0 || startEmpty {
+		args = append(args,
+			strconv.FormatFloat(reserve, 'f', -1, 64),
+			strconv.FormatInt(limit.Overdraft, 10),
+			strconv.FormatBool(startEmpty),
+		)
+	}
+
+	if err := l.evalScript(ctx, &resp, script, keys, args...); err != nil {
 		return nil, err
 	}
-	if len(resp) != 4 {
-		return nil, fmt.Errorf("unexpected redis response, got %d items", len(resp))
+	return parseResult(limit, resp)
+}
+
+// parseResult decodes the reply of the allow_n, lease and window scripts.
+func parseResult(limit Limit, resp []interface{}) (*RateLimitResult, error) {
+	if len(resp) != 5 {
+		return nil, fmt.Errorf("%w: got %d items, want 5", ErrUnexpectedResponse, len(resp))
 	}
 
 	allowed, err := strconv.ParseInt(fmt.Sprint(resp[0]), 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("parse limited: %w", err)
+		return nil, responseErr("parse allowed", err)
 	}
 	remaining, err := strconv.ParseInt(fmt.Sprint(resp[1]), 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("parse remaining: %w", err)
+		return nil, responseErr("parse remaining", err)
 	}
 	retryAfter, err := parseDurationSeconds(resp[2])
 	if err != nil {
-		return nil, fmt.Errorf("parse retry_after: %w", err)
+		return nil, responseErr("parse retry_after", err)
 	}
 	resetAfter, err := parseDurationSeconds(resp[3])
 	if err != nil {
-		return nil, fmt.Errorf("parse reset_after: %w", err)
+		return nil, responseErr("parse reset_after", err)
+	}
+	reason, err := strconv.ParseInt(fmt.Sprint(resp[4]), 10, 64)
+	if err != nil {
+		return nil, responseErr("parse reason", err)
 	}
 
 	return &RateLimitResult{
@@ -179,6 +447,7 @@ func (l Limiter) runAllow(key string, limit Limit, cost int64) (*RateLimitResult
 		Remaining:  remaining,
 		RetryAfter: retryAfter,
 		ResetAfter: resetAfter,
+		Reason:     Reason(reason),
 	}, nil
 }
 
@@ -194,7 +463,8 @@ func parseDurationSeconds(raw interface{}) (*time.Duration, error) {
 	if err != nil {
 		return nil, err
 	}
-	d := time.Duration(seconds * float64(time.Second))
+	// Round so that durations survive a round trip through seconds.
+	d := time.Duration(math.Round(seconds * float64(time.Second)))
 	return &d, nil
 }
 
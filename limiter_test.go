@@ -5,6 +5,9 @@ package leakybucketgcra_test
 
 import (
 	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -94,6 +97,7 @@ func TestCostBiggerThanBurst(t *testing.T) {
 	}
 	require.Nil(t, res.RetryAfter)
 	assert.Equal(t, time.Duration(0), *res.ResetAfter)
+	assert.Equal(t, gcra.ReasonCostExceedsBurst, res.Reason)
 
 }
 
@@ -371,6 +375,344 @@ func TestRemaining(t *testing.T) {
 	}
 }
 
+func TestOverridesInvalidatedAcrossInstances(t *testing.T) {
+	newLimiter := func() *gcra.Limiter {
+		client, err := gcra.NewRadixClient("tcp", "127.0.0.1:6379", 4, false)
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		l := gcra.NewLimiter(client, gcra.WithOverrides(gcra.OverrideOptions{Key: "test:overrides", TTL: time.Hour}))
+		t.Cleanup(func() { l.Close() })
+		return l
+	}
+	admin, worker := newLimiter(), newLimiter()
+	key := "test:override:acme"
+	resetKey(t, worker, key)
+	resetKey(t, worker, "test:overrides")
+	limit := gcra.PerSecond(1, 1)
+
+	res := call(t, worker, key, limit, 5)
+	require.Equal(t, int64(0), res.Allowed)
+
+	// The worker cached the absence of an override for an hour; pub/sub must
+	// invalidate it.
+	require.NoError(t, admin.SetOverride(key, gcra.PerSecond(10, 10)))
+	require.Eventually(t, func() bool {
+		return call(t, worker, key, limit, 5).Allowed == 5
+	}, time.Second, 10*time.Millisecond)
+
+	overrides, err := worker.ListOverrides()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]gcra.Limit{key: gcra.PerSecond(10, 10)}, overrides)
+	require.NoError(t, admin.ClearOverride(key))
+}
+
+func TestLeasingAgainstRedis(t *testing.T) {
+	client, err := gcra.NewRadixClient("tcp", "127.0.0.1:6379", 4, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	leasing := gcra.NewLimiter(client, gcra.WithLeasing(gcra.LeaseOptions{Size: 4, MaxStaleness: time.Minute}))
+	plain := newTestLimiter(t)
+	key := "test:lease"
+	resetKey(t, plain, key)
+	limit := gcra.PerMinute(1, 10)
+
+	// The first and fifth calls each lease 4 tokens.
+	for i := 0; i < 5; i++ {
+		require.Equal(t, int64(1), call(t, leasing, key, limit, 1).Allowed)
+	}
+	require.Equal(t, int64(0), call(t, plain, key, limit, 3).Allowed)
+	require.Equal(t, int64(2), call(t, plain, key, limit, 2).Allowed)
+
+	// Closing returns the 3 unused tokens.
+	require.NoError(t, leasing.Close())
+	require.Equal(t, int64(3), call(t, plain, key, limit, 3).Allowed)
+}
+
+func TestCoalescingAgainstRedis(t *testing.T) {
+	client, err := gcra.NewRadixClient("tcp", "127.0.0.1:6379", 4, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	limiter := gcra.NewLimiter(client, gcra.WithCoalescing(10*time.Millisecond))
+	key := "test:coalesce"
+	resetKey(t, limiter, key)
+	limit := gcra.PerMinute(1, 10)
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := limiter.Allow(key, limit)
+			assert.NoError(t, err)
+			allowed.Add(res.Allowed)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), allowed.Load())
+}
+
+func TestWindowAlgorithms(t *testing.T) {
+	limiter := newTestLimiter(t)
+	for _, algorithm := range []gcra.Algorithm{
+		gcra.AlgorithmFixedWindow, gcra.AlgorithmSlidingWindowLog, gcra.AlgorithmSlidingWindowCounter,
+	} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			key := "test:window"
+			resetKey(t, limiter, key)
+			limit := gcra.Limit{Rate: 5, Period: time.Hour, Algorithm: algorithm}
+
+			res := call(t, limiter, key, limit, 3)
+			assert.Equal(t, int64(3), res.Allowed)
+			assert.Equal(t, int64(2), res.Remaining)
+			res = call(t, limiter, key, limit, 3)
+			assert.Equal(t, int64(0), res.Allowed)
+			assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+			require.NotNil(t, res.RetryAfter)
+			assert.Equal(t, int64(2), call(t, limiter, key, limit, 2).Allowed)
+			assert.Equal(t, gcra.ReasonCostExceedsBurst, call(t, limiter, key, limit, 6).Reason)
+		})
+	}
+}
+
+func TestConcurrencyLimiterAgainstRedis(t *testing.T) {
+	client, err := gcra.NewRadixClient("tcp", "127.0.0.1:6379", 4, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	require.NoError(t, client.DoCmd(nil, "DEL", "test:exports:slots"))
+	sem := gcra.NewConcurrencyLimiter(client, gcra.ConcurrencyOptions{LeaseTTL: 200 * time.Millisecond})
+
+	slot, err := sem.Acquire("test:exports", 1)
+	require.NoError(t, err)
+	_, err = sem.Acquire("test:exports", 1)
+	require.ErrorIs(t, err, gcra.ErrLimited)
+
+	require.NoError(t, slot.Renew())
+	require.NoError(t, slot.Release())
+	leaked, err := sem.Acquire("test:exports", 1)
+	require.NoError(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+	require.ErrorIs(t, leaked.Renew(), gcra.ErrSlotExpired)
+	_, err = sem.Acquire("test:exports", 1)
+	require.NoError(t, err)
+}
+
+func TestQuotaAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	quota := gcra.Daily(5, time.UTC)
+	require.NoError(t, limiter.ResetQuota("test:quota", quota))
+
+	res, err := limiter.AllowQuota("test:quota", quota, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, int64(2), res.Remaining)
+
+	res, err = limiter.AllowQuota("test:quota", quota, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, int64(3), res.Used)
+	_, end := quota.Bounds(time.Now())
+	assert.Equal(t, end, res.ResetAt)
+}
+
+func TestStartEmptyBucketOutlivesItsTTL(t *testing.T) {
+	limiter := newTestLimiter(t)
+	resetKey(t, limiter, "test:start_empty")
+	bucket := gcra.TokenBucket{Capacity: 1, Refill: 1, Interval: time.Second, StartEmpty: true}
+
+	res, err := limiter.AllowBucket("test:start_empty", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+
+	// Well past the time the full bucket's TAT would have expired.
+	time.Sleep(3500 * time.Millisecond)
+	res, err = limiter.AllowBucket("test:start_empty", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	time.Sleep(3500 * time.Millisecond)
+	res, err = limiter.AllowBucket("test:start_empty", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+}
+
+func TestAllowHierarchyAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	resetKey(t, limiter, "test:org")
+	resetKey(t, limiter, "test:user")
+	path := []gcra.Node{
+		{Key: "test:org", Limit: gcra.PerMinute(1, 3)},
+		{Key: "test:user", Limit: gcra.PerMinute(1, 5)},
+	}
+
+	res, err := limiter.AllowHierarchy(path, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	assert.Equal(t, 0, res.Bottleneck)
+
+	res, err = limiter.AllowHierarchy(path, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 0, res.Bottleneck)
+	assert.Equal(t, int64(3), res.Levels[1].Remaining)
+
+	// The user level was not charged for the denied request.
+	assert.Equal(t, int64(3), call(t, limiter, "test:user", path[1].Limit, 3).Allowed)
+}
+
+func TestAllowFairAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	for _, key := range []string{"test:fair", "test:fair:tenant:a", "test:fair:tenant:b", "test:fair:active", "test:fair:weights", "test:fair:weight_total"} {
+		resetKey(t, limiter, key)
+	}
+	fs := gcra.FairShare{Key: "test:fair", Limit: gcra.PerMinute(10, 10)}
+
+	res, err := limiter.AllowFair(fs, "a", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	assert.Equal(t, 1.0, res.Share)
+
+	res, err = limiter.AllowFair(fs, "b", 4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), res.Allowed)
+	assert.InDelta(t, 0.8, res.Share, 1e-9)
+	assert.Equal(t, int64(2), res.Active)
+
+	// The global bucket is empty, so a is denied despite room in its share.
+	res, err = limiter.AllowFair(fs, "a", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.True(t, res.Global)
+}
+
+func TestOverdraftAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	key := "test:overdraft"
+	resetKey(t, limiter, key)
+	limit := gcra.PerMinute(1, 2)
+	borrowing := limit
+	borrowing.Overdraft = 3
+
+	assert.Equal(t, int64(2), call(t, limiter, key, limit, 2).Allowed)
+	res := call(t, limiter, key, borrowing, 3)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, int64(-3), res.Remaining)
+
+	res = call(t, limiter, key, limit, 1)
+	assert.Equal(t, int64(0), res.Allowed)
+	require.NotNil(t, res.RetryAfter)
+	assert.InDelta(t, 4*time.Minute, *res.RetryAfter, float64(time.Second))
+}
+
+func TestTokenBucketStartEmptyAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	key := "test:tokenbucket"
+	resetKey(t, limiter, key)
+	bucket := gcra.TokenBucket{Capacity: 2, Refill: 1, Interval: time.Minute, StartEmpty: true}
+
+	res, err := limiter.AllowBucket(key, bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	require.NotNil(t, res.RetryAfter)
+	assert.InDelta(t, time.Minute, *res.RetryAfter, float64(time.Second))
+
+	// The denial stored the empty bucket rather than starting over.
+	res, err = limiter.AllowBucket(key, bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	require.NotNil(t, res.ResetAfter)
+	assert.InDelta(t, 2*time.Minute, *res.ResetAfter, float64(time.Second))
+}
+
+func TestRateLimiterAgainstRedis(t *testing.T) {
+	limiter := newTestLimiter(t)
+	key := "test:xrate"
+	resetKey(t, limiter, key)
+	lim := gcra.NewRateLimiter(limiter, key, gcra.PerMinute(1, 1))
+
+	assert.True(t, lim.Allow())
+	r := lim.Reserve()
+	require.True(t, r.OK())
+	assert.InDelta(t, time.Minute, r.Delay(), float64(time.Second))
+	assert.False(t, lim.Allow())
+
+	r.Cancel()
+	r = lim.Reserve()
+	require.True(t, r.OK())
+	assert.InDelta(t, time.Minute, r.Delay(), float64(time.Second))
+}
+
+// TestDecideMatchesScript runs the allow_n script with its clock replaced by
+// arguments and checks that Decide agrees with it exactly, for random states,
+// limits, costs and times.
+func TestDecideMatchesScript(t *testing.T) {
+	client, err := gcra.NewRadixClient("tcp", "127.0.0.1:6379", 4, false)
+	if err != nil {
+		t.Fatalf("redis not available: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	script := strings.Replace(gcra.AllowNScriptSrc, `local now = redis.call("TIME")`, `local now = {ARGV[8], ARGV[9]}`, 1)
+	require.NotEqual(t, gcra.AllowNScriptSrc, script)
+	key := "test:conformance"
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	periods := []time.Duration{250 * time.Millisecond, time.Second, 7 * time.Second, time.Minute, time.Hour}
+	for i := 0; i < 2000; i++ {
+		limit := gcra.Limit{Rate: 1 + rng.Int64N(1000), Burst: rng.Int64N(200), Period: periods[rng.IntN(len(periods))]}
+		if rng.IntN(4) == 0 {
+			limit.Overdraft = rng.Int64N(20)
+		}
+		var reserves gcra.PriorityReserves
+		if rng.IntN(4) == 0 {
+			reserves.Normal = rng.Float64()
+		}
+		reserve := reserves.Normal * float64(limit.Burst)
+		cost := rng.Int64N(220)
+		now := time.Unix(1483228800+rng.Int64N(3e8), rng.Int64N(1e9))
+		sec, usec := now.Unix(), now.Nanosecond()/1000
+
+		emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+		var state gcra.State
+		if rng.IntN(3) > 0 {
+			offset := (rng.Float64()*2 - 0.5) * emissionInterval * float64(limit.Burst+limit.Overdraft+1)
+			state = gcra.State{TAT: float64(sec-1483228800) + float64(usec)/1e6 + offset, Exists: true}
+			require.NoError(t, client.DoCmd(nil, "SET", key, strconv.FormatFloat(state.TAT, 'g', -1, 64)))
+		} else {
+			require.NoError(t, client.DoCmd(nil, "DEL", key))
+		}
+
+		var resp []interface{}
+		require.NoError(t, client.EvalScript(&resp, script, []string{key},
+			strconv.FormatInt(limit.Burst, 10),
+			strconv.FormatInt(limit.Rate, 10),
+			strconv.FormatFloat(limit.Period.Seconds(), 'f', -1, 64),
+			strconv.FormatInt(cost, 10),
+			strconv.FormatFloat(reserve, 'f', -1, 64),
+			strconv.FormatInt(limit.Overdraft, 10),
+			"false",
+			strconv.FormatInt(sec, 10),
+			strconv.Itoa(usec),
+		))
+		want, err := gcra.ParseResult(limit, resp)
+		require.NoError(t, err)
+
+		got, next, err := gcra.DecidePriority(state, limit, cost, gcra.PriorityNormal, reserves, now)
+		require.NoError(t, err)
+		desc := fmt.Sprintf("case %d: %s cost %d reserve %g state %+v", i, limit, cost, reserve, state)
+		require.Equal(t, want, got, desc)
+
+		var stored string
+		require.NoError(t, client.DoCmd(&stored, "GET", key))
+		if !next.Exists {
+			require.Empty(t, stored, desc)
+			continue
+		}
+		tat, err := strconv.ParseFloat(stored, 64)
+		require.NoError(t, err, desc)
+		require.Equal(t, tat, next.TAT, desc)
+	}
+}
+
 func BenchmarkAllowN(b *testing.B) {
 	limiter := newBenchLimiter(b)
 	limit := gcra.PerSecond(1e6, 1e6) // 1 million req/sec, burst 1 million
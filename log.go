@@ -0,0 +1,100 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultLogsPerSecond = 10
+
+// LogOptions configures logging enabled by WithLogger.
+type LogOptions struct {
+	// RawKeys logs rate limit keys verbatim. By default keys are replaced by
+	// an unsalted hash, which correlates records without printing keys but
+	// does not keep guessable keys secret.
+	RawKeys bool
+
+	// MaxPerSecond caps the number of records the Limiter logs per second.
+	// Records over the cap are dropped and their count is attached to the
+	// next record that is logged. Defaults to 10.
+	MaxPerSecond int
+}
+
+// WithLogger makes the Limiter log denials at debug level and backend
+// failures at warn level, with the key and limit as attributes.
+func WithLogger(logger *slog.Logger, opts LogOptions) Option {
+	return func(l *Limiter) {
+		if opts.MaxPerSecond <= 0 {
+			opts.MaxPerSecond = defaultLogsPerSecond
+		}
+		l.log = &limiterLog{logger: logger, opts: opts}
+	}
+}
+
+// limiterLog writes limiter records, rate limiting its own output.
+type limiterLog struct {
+	logger *slog.Logger
+	opts   LogOptions
+
+	mu         sync.Mutex
+	window     time.Time
+	count      int
+	suppressed int
+}
+
+func (g *limiterLog) keyAttr(key string) slog.Attr {
+	if g.opts.RawKeys {
+		return slog.String("key", key)
+	}
+	return slog.String("key_hash", hashKey(key))
+}
+
+// denied logs a denial at debug level.
+func (g *limiterLog) denied(ctx context.Context, key string, cost int64, res *RateLimitResult) {
+	if g == nil || !g.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{g.keyAttr(key), slog.String("limit", res.Limit.String()), slog.Int64("cost", cost),
+		slog.String("reason", res.Reason.String())}
+	if res.RetryAfter != nil {
+		attrs = append(attrs, slog.Duration("retry_after", *res.RetryAfter))
+	}
+	g.emit(ctx, slog.LevelDebug, "rate limit exceeded", attrs)
+}
+
+// backendError logs a failed Redis call at warn level. limit is nil for
+// operations that are not tied to a limit.
+func (g *limiterLog) backendError(ctx context.Context, op, key string, limit *Limit, err error, degraded bool) {
+	if g == nil || !g.logger.Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+	attrs := []slog.Attr{slog.String("op", op), g.keyAttr(key), slog.Any("error", err)}
+	if limit != nil {
+		attrs = append(attrs, slog.String("limit", limit.String()), slog.Bool("fail_open", degraded))
+	}
+	g.emit(ctx, slog.LevelWarn, "rate limit backend failure", attrs)
+}
+
+func (g *limiterLog) emit(ctx context.Context, level slog.Level, msg string, attrs []slog.Attr) {
+	g.mu.Lock()
+	now := time.Now()
+	if now.Sub(g.window) >= time.Second {
+		g.window, g.count = now, 0
+	}
+	if g.count >= g.opts.MaxPerSecond {
+		g.suppressed++
+		g.mu.Unlock()
+		return
+	}
+	g.count++
+	suppressed := g.suppressed
+	g.suppressed = 0
+	g.mu.Unlock()
+
+	if suppressed > 0 {
+		attrs = append(attrs, slog.Int("suppressed", suppressed))
+	}
+	g.logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,69 @@
+package leakybucketgcra_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+// failingClient fails every script execution.
+type failingClient struct {
+	gcra.Client
+}
+
+func (failingClient) EvalScript(interface{}, string, []string, ...interface{}) error {
+	return errors.New("connection refused")
+}
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestLoggerDenialsAndFailures(t *testing.T) {
+	var buf bytes.Buffer
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock, gcra.WithLogger(newTestLogger(&buf), gcra.LogOptions{}))
+
+	limiter.Allow("user:42", gcra.PerSecond(1, 1))
+	limiter.Allow("user:42", gcra.PerSecond(1, 1))
+	assert.Contains(t, buf.String(), `level=DEBUG msg="rate limit exceeded" key_hash=`)
+	assert.Contains(t, buf.String(), `limit="1 req/s (burst 1)" cost=1 reason=rate_exceeded retry_after=1s`)
+	assert.NotContains(t, buf.String(), "user:42")
+
+	buf.Reset()
+	failing := gcra.NewLimiter(failingClient{mock},
+		gcra.WithLogger(newTestLogger(&buf), gcra.LogOptions{RawKeys: true}), gcra.WithFailOpen())
+	res, err := failing.Allow("user:42", gcra.PerSecond(1, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, `level=WARN msg="rate limit backend failure" op=allow key=user:42 error="rate limit backend unavailable: connection refused" limit="1 req/s (burst 1)" fail_open=true`+"\n", buf.String())
+}
+
+func TestLoggerRateLimitsItself(t *testing.T) {
+	var buf bytes.Buffer
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(failingClient{mock}, gcra.WithLogger(newTestLogger(&buf), gcra.LogOptions{MaxPerSecond: 2}))
+
+	for i := 0; i < 10; i++ {
+		_, err := limiter.Allow("user:42", gcra.PerSecond(1, 1))
+		require.Error(t, err)
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+}
@@ -4,6 +4,7 @@ package leakybucketgcra
 // https://github.com/rwz/redis-gcra/blob/master/vendor/perform_gcra_ratelimit.lua
 // allowNScriptSrc is the Lua source for the limiter.
 var allowNScriptSrc = `
+-- name: allow_n
 redis.replicate_commands()
 
 local rate_limit_key = KEYS[1]
@@ -11,10 +12,21 @@ local burst = tonumber(ARGV[1])
 local rate = tonumber(ARGV[2])
 local period = tonumber(ARGV[3])
 local cost = tonumber(ARGV[4])
+local reserve = tonumber(ARGV[5]) or 0
+local overdraft = tonumber(ARGV[6]) or 0
+local start_empty = ARGV[7] == "true"
+-- A start-empty bucket is kept this long after it fills, so that an idle
+-- key comes back full rather than empty again.
+local keep_full = 0
+if start_empty then
+  keep_full = 86400
+end
 
 local emission_interval = period / rate
 local increment = emission_interval * cost
-local burst_offset = emission_interval * burst
+-- The last reserve tokens are kept for higher priorities, and up to
+-- overdraft tokens may be borrowed beyond an empty bucket.
+local burst_offset = emission_interval * (burst - reserve + overdraft)
 local now = redis.call("TIME")
 
 local jan_1_2017 = 1483228800
@@ -24,13 +36,28 @@ local tat = redis.call("GET", rate_limit_key)
 
 if not tat then
   tat = now
+  if start_empty and burst > 0 then
+    -- Store the empty bucket so that it fills even if this request is denied.
+    tat = now + emission_interval * burst
+    redis.call("SET", rate_limit_key, tat, "EX", math.ceil(tat - now) + keep_full)
+  end
 else
   tat = tonumber(tat)
 end
 
+-- Reason codes match the Reason constants in Go.
+local reason_allowed = 0
+local reason_rate_exceeded = 1
+local reason_cost_exceeds_burst = 2
+local reason_reserved = 5
+
 -- Impossible request: cost larger than burst. Deny (no retry).
-if cost > burst then
-   return {0, 0, "-1", tostring(tat - now)}
+if cost > burst + overdraft then
+   return {0, 0, "-1", tostring(tat - now), reason_cost_exceeds_burst}
+end
+
+if cost > burst - reserve + overdraft then
+   return {0, 0, "-1", tostring(tat - now), reason_reserved}
 end
 
 local new_tat = math.max(tat, now) + increment
@@ -42,21 +69,637 @@ local allowed
 local retry_after
 local reset_after
 local remaining
+local reason
 
 if diff < 0 then
   allowed = 0
   remaining = 0
   reset_after = tat - now
   retry_after = diff * -1
+  if diff + reserve * emission_interval < 0 then
+    reason = reason_rate_exceeded
+  else
+    reason = reason_reserved
+  end
 else
   allowed = cost
-  remaining = math.floor(diff / emission_interval + 0.5)
+  -- Negative while borrowed tokens are owed.
+  remaining = math.floor(diff / emission_interval + 0.5) - overdraft
   reset_after = new_tat - now
-  redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after))
+  redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after) + keep_full)
   retry_after = -1
+  reason = reason_allowed
+end
+
+return {allowed, remaining, tostring(retry_after), tostring(reset_after), reason}
+`
+
+// leaseScriptSrc grants between ARGV[4] and ARGV[5] tokens at once, as many
+// as the bucket holds. Denials are reported exactly as allowNScriptSrc would
+// report a request for the minimum.
+var leaseScriptSrc = `
+-- name: lease
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local min_cost = tonumber(ARGV[4])
+local max_cost = tonumber(ARGV[5])
+
+local emission_interval = period / rate
+local burst_offset = emission_interval * burst
+local now = redis.call("TIME")
+
+local jan_1_2017 = 1483228800
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+
+local reason_allowed = 0
+local reason_rate_exceeded = 1
+local reason_cost_exceeds_burst = 2
+
+if min_cost > burst then
+   return {0, 0, "-1", tostring(tat - now), reason_cost_exceeds_burst}
+end
+
+local base = math.max(tat, now)
+local cost = math.min(max_cost, burst, math.floor((now + burst_offset - base) / emission_interval))
+if cost < min_cost then
+  cost = min_cost
+end
+
+local new_tat = base + emission_interval * cost
+local diff = now - (new_tat - burst_offset)
+
+if diff < 0 then
+  return {0, 0, tostring(diff * -1), tostring(tat - now), reason_rate_exceeded}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after))
+local remaining = math.floor(diff / emission_interval + 0.5)
+return {cost, remaining, "-1", tostring(reset_after), reason_allowed}
+`
+
+// returnTokensScriptSrc gives ARGV[3] unused tokens back to the bucket by
+// moving its theoretical arrival time earlier.
+var returnTokensScriptSrc = `
+-- name: return_tokens
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local tokens = tonumber(ARGV[3])
+
+local now = redis.call("TIME")
+local jan_1_2017 = 1483228800
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+if not tat then
+  return {0}
+end
+
+-- Keep the key's TTL: deleting a full bucket would make a start-empty one
+-- start empty again.
+local new_tat = math.max(tonumber(tat) - (period / rate) * tokens, now)
+local ttl = redis.call("PTTL", rate_limit_key)
+if ttl > 0 then
+  redis.call("SET", rate_limit_key, new_tat, "PX", ttl)
+else
+  redis.call("SET", rate_limit_key, new_tat)
+end
+return {tokens}
+`
+
+// allowBatchScriptSrc runs allowNScriptSrc for each cost in ARGV[4:] in
+// order, as if the requests had arrived one after another at the same
+// instant, and returns the five result fields of each request in turn.
+var allowBatchScriptSrc = `
+-- name: allow_batch
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+
+local emission_interval = period / rate
+local burst_offset = emission_interval * burst
+local now = redis.call("TIME")
+
+local jan_1_2017 = 1483228800
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+
+local reason_allowed = 0
+local reason_rate_exceeded = 1
+local reason_cost_exceeds_burst = 2
+
+local results = {}
+local changed = false
+
+for i = 4, #ARGV do
+  local cost = tonumber(ARGV[i])
+  if cost > burst then
+    table.insert(results, 0)
+    table.insert(results, 0)
+    table.insert(results, "-1")
+    table.insert(results, tostring(tat - now))
+    table.insert(results, reason_cost_exceeds_burst)
+  else
+    local new_tat = math.max(tat, now) + emission_interval * cost
+    local diff = now - (new_tat - burst_offset)
+    if diff < 0 then
+      table.insert(results, 0)
+      table.insert(results, 0)
+      table.insert(results, tostring(diff * -1))
+      table.insert(results, tostring(tat - now))
+      table.insert(results, reason_rate_exceeded)
+    else
+      tat = new_tat
+      changed = true
+      table.insert(results, cost)
+      table.insert(results, math.floor(diff / emission_interval + 0.5))
+      table.insert(results, "-1")
+      table.insert(results, tostring(new_tat - now))
+      table.insert(results, reason_allowed)
+    end
+  end
+end
+
+if changed then
+  redis.call("SET", rate_limit_key, tat, "EX", math.ceil(tat - now))
+end
+
+return results
+`
+
+// fixedWindowScriptSrc counts requests in calendar-aligned windows of
+// ARGV[3] seconds. The counter expires when its window ends.
+var fixedWindowScriptSrc = `
+-- name: fixed_window
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+local window_end = (math.floor(now / period) + 1) * period
+local count = tonumber(redis.call("GET", key) or "0")
+local reset_after = 0
+if count > 0 then
+  reset_after = window_end - now
+end
+
+if cost > rate then
+  return {0, 0, "-1", tostring(reset_after), 2}
+end
+
+if count + cost > rate then
+  return {0, 0, tostring(window_end - now), tostring(reset_after), 1}
+end
+
+count = redis.call("INCRBY", key, cost)
+redis.call("PEXPIREAT", key, math.ceil(window_end * 1000))
+return {cost, rate - count, "-1", tostring(window_end - now), 0}
+`
+
+// slidingWindowLogScriptSrc logs every granted token in a sorted set scored
+// by time, and allows a request if fewer than ARGV[2] tokens were granted in
+// the last ARGV[3] seconds.
+var slidingWindowLogScriptSrc = `
+-- name: sliding_window_log
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local id = ARGV[5]
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - period)
+local count = redis.call("ZCARD", key)
+
+local function reset_after()
+  local newest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+  if #newest == 0 then
+    return 0
+  end
+  return tonumber(newest[2]) + period - now
+end
+
+if cost > rate then
+  return {0, 0, "-1", tostring(reset_after()), 2}
+end
+
+if count + cost > rate then
+  -- The oldest count + cost - rate entries must leave the window first.
+  local i = count + cost - rate - 1
+  local entry = redis.call("ZRANGE", key, i, i, "WITHSCORES")
+  return {0, 0, tostring(tonumber(entry[2]) + period - now), tostring(reset_after()), 1}
+end
+
+for i = 1, cost do
+  redis.call("ZADD", key, now, id .. ":" .. i)
+end
+redis.call("PEXPIRE", key, math.ceil(period * 1000))
+return {cost, rate - count - cost, "-1", tostring(period), 0}
+`
+
+// slidingWindowCounterScriptSrc keeps the counts of the current and previous
+// calendar-aligned windows and estimates the sliding count as the current
+// count plus the previous one weighted by its overlap with the sliding window.
+var slidingWindowCounterScriptSrc = `
+-- name: sliding_window_counter
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+local window = math.floor(now / period)
+local elapsed = now / period - window
+
+local state = redis.call("HMGET", key, "window", "cur", "prev")
+local last = tonumber(state[1])
+local cur = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if last == window - 1 then
+  prev, cur = cur, 0
+elseif last ~= window then
+  prev, cur = 0, 0
+end
+
+local count = cur + prev * (1 - elapsed)
+local reset_after = 0
+if cur > 0 then
+  reset_after = (2 - elapsed) * period
+elseif prev > 0 then
+  reset_after = (1 - elapsed) * period
+end
+
+if cost > rate then
+  return {0, 0, "-1", tostring(reset_after), 2}
+end
+
+if count + cost > rate then
+  local retry_after
+  if cur + cost <= rate then
+    -- Wait for the previous window's weight to decay enough.
+    retry_after = (1 - (rate - cur - cost) / prev - elapsed) * period
+  else
+    -- Wait for the next window, where this window's count decays.
+    retry_after = (1 - elapsed + math.max(0, 1 - (rate - cost) / cur)) * period
+  end
+  return {0, 0, tostring(retry_after), tostring(reset_after), 1}
+end
+
+cur = cur + cost
+redis.call("HSET", key, "window", window, "cur", cur, "prev", prev)
+redis.call("PEXPIRE", key, math.ceil(2 * period * 1000))
+return {cost, math.floor(rate - count - cost), "-1", tostring((2 - elapsed) * period), 0}
+`
+
+// acquireSlotScriptSrc adds ARGV[3] to the sorted set of slots, scored by
+// lease expiry, unless ARGV[1] unexpired slots are already held. It returns
+// whether the slot was acquired, the slots in use and, when full, the
+// seconds until the earliest lease expires.
+var acquireSlotScriptSrc = `
+-- name: acquire_slot
+redis.replicate_commands()
+
+local key = KEYS[1]
+local max = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local id = ARGV[3]
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+local count = redis.call("ZCARD", key)
+if count >= max then
+  local earliest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+  return {0, count, tostring(tonumber(earliest[2]) - now)}
+end
+
+redis.call("ZADD", key, now + ttl, id)
+local latest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", key, math.ceil(tonumber(latest[2]) * 1000))
+return {1, count + 1, "-1"}
+`
+
+// renewSlotScriptSrc extends the lease of slot ARGV[2] by ARGV[1] seconds
+// from now. It returns 0 if the slot expired or was released.
+var renewSlotScriptSrc = `
+-- name: renew_slot
+redis.replicate_commands()
+
+local key = KEYS[1]
+local ttl = tonumber(ARGV[1])
+local id = ARGV[2]
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+local expires = redis.call("ZSCORE", key, id)
+if not expires or tonumber(expires) <= now then
+  redis.call("ZREM", key, id)
+  return {0}
+end
+
+redis.call("ZADD", key, now + ttl, id)
+local latest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", key, math.ceil(tonumber(latest[2]) * 1000))
+return {1}
+`
+
+// releaseSlotScriptSrc removes slot ARGV[1].
+var releaseSlotScriptSrc = `
+-- name: release_slot
+return {redis.call("ZREM", KEYS[1], ARGV[1])}
+`
+
+// quotaScriptSrc adds ARGV[2] to the counter of a calendar period unless
+// that would exceed ARGV[1]. The counter expires at the end of the period,
+// ARGV[3] milliseconds since the Unix epoch. It returns whether the request
+// was allowed and the usage afterwards.
+var quotaScriptSrc = `
+-- name: quota
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local expires_at = tonumber(ARGV[3])
+
+local used = tonumber(redis.call("GET", key) or "0")
+if used + cost > limit then
+  return {0, used}
+end
+if cost > 0 then
+  used = redis.call("INCRBY", key, cost)
+  redis.call("PEXPIREAT", key, expires_at)
 end
+return {1, used}
+`
+
+// allowHierarchyScriptSrc charges ARGV[1] tokens to every key in KEYS, each
+// with its own burst, rate and period in ARGV[2:], or to none of them: the
+// request is allowed only if every level allows it. It returns the five
+// result fields of allowNScriptSrc for each level in turn. When the request
+// is denied, levels that had room report Allowed 0 and their state before
+// the request.
+var allowHierarchyScriptSrc = `
+-- name: allow_hierarchy
+redis.replicate_commands()
+
+local cost = tonumber(ARGV[1])
+
+local now = redis.call("TIME")
+local jan_1_2017 = 1483228800
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local results = {}
+local new_tats = {}
+local resets = {}
+local denied = false
+
+for i, key in ipairs(KEYS) do
+  local burst = tonumber(ARGV[3 * i - 1])
+  local rate = tonumber(ARGV[3 * i])
+  local period = tonumber(ARGV[3 * i + 1])
 
-return {allowed, remaining, tostring(retry_after), tostring(reset_after)}
+  local emission_interval = period / rate
+  local burst_offset = emission_interval * burst
+
+  local tat = redis.call("GET", key)
+  if not tat then
+    tat = now
+  else
+    tat = tonumber(tat)
+  end
+
+  if cost > burst then
+    denied = true
+    results[i] = {0, 0, "-1", tostring(tat - now), 2}
+  else
+    local new_tat = math.max(tat, now) + emission_interval * cost
+    local diff = now - (new_tat - burst_offset)
+    if diff < 0 then
+      denied = true
+      results[i] = {0, 0, tostring(diff * -1), tostring(tat - now), 1}
+    else
+      new_tats[i] = new_tat
+      resets[i] = tostring(math.max(tat - now, 0))
+      results[i] = {cost, math.floor(diff / emission_interval + 0.5), "-1", tostring(new_tat - now), 0}
+    end
+  end
+end
+
+local out = {}
+for i, key in ipairs(KEYS) do
+  local r = results[i]
+  if new_tats[i] then
+    if denied then
+      r[1] = 0
+      r[2] = r[2] + cost
+      r[4] = resets[i]
+    else
+      redis.call("SET", key, new_tats[i], "EX", math.ceil(new_tats[i] - now))
+    end
+  end
+  for _, v in ipairs(r) do
+    table.insert(out, v)
+  end
+end
+return out
+`
+
+// adaptScriptSrc applies one additive-increase/multiplicative-decrease step
+// to the rate of class ARGV[1], stored in hash KEYS[1], unless the rate
+// changed less than ARGV[8] seconds ago. ARGV[2] is 1 to increase and -1 to
+// decrease. It returns the current rate in a one-element array.
+var adaptScriptSrc = `
+-- name: adapt
+redis.replicate_commands()
+
+local key = KEYS[1]
+local class = ARGV[1]
+local verdict = tonumber(ARGV[2])
+local initial = tonumber(ARGV[3])
+local min_rate = tonumber(ARGV[4])
+local max_rate = tonumber(ARGV[5])
+local step = tonumber(ARGV[6])
+local factor = tonumber(ARGV[7])
+local interval = tonumber(ARGV[8])
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+local state = redis.call("HMGET", key, class, class .. ":at")
+local rate = tonumber(state[1]) or initial
+local at = tonumber(state[2]) or 0
+if now - at < interval then
+  return {rate}
+end
+
+if verdict > 0 then
+  rate = math.min(max_rate, rate + step)
+else
+  rate = math.max(min_rate, math.floor(rate * factor))
+end
+redis.call("HSET", key, class, rate, class .. ":at", tostring(now))
+return {rate}
+`
+
+// fairShareScriptSrc charges ARGV[1] tokens to the global bucket KEYS[1]
+// and to tenant ARGV[5]'s bucket KEYS[2], or to neither. The tenant's share
+// of the global burst ARGV[2] and rate ARGV[3] per ARGV[4] seconds is its
+// weight ARGV[6] over the total weight of the tenants active in the last
+// ARGV[7] seconds. Activity is kept in the sorted set KEYS[3], weights in the
+// hash KEYS[4] and their total in KEYS[5]. It returns the five result fields
+// of allowNScriptSrc for the global and the tenant bucket, as
+// allowHierarchyScriptSrc does, followed by the share and the number of
+// active tenants.
+var fairShareScriptSrc = `
+-- name: fair_share
+redis.replicate_commands()
+
+local global_key = KEYS[1]
+local tenant_key = KEYS[2]
+local active_key = KEYS[3]
+local weights_key = KEYS[4]
+local total_key = KEYS[5]
+
+local cost = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local period = tonumber(ARGV[4])
+local tenant = ARGV[5]
+local weight = tonumber(ARGV[6])
+local window = tonumber(ARGV[7])
+
+local now = redis.call("TIME")
+local jan_1_2017 = 1483228800
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+-- Forget tenants that went quiet, then record this one.
+local expired = redis.call("ZRANGEBYSCORE", active_key, "-inf", now - window)
+for _, member in ipairs(expired) do
+  local w = redis.call("HGET", weights_key, member)
+  if w then
+    redis.call("INCRBYFLOAT", total_key, -tonumber(w))
+    redis.call("HDEL", weights_key, member)
+  end
+end
+redis.call("ZREMRANGEBYSCORE", active_key, "-inf", now - window)
+
+local old = tonumber(redis.call("HGET", weights_key, tenant)) or 0
+redis.call("HSET", weights_key, tenant, weight)
+redis.call("ZADD", active_key, now, tenant)
+local active = redis.call("ZCARD", active_key)
+local total
+if active == 1 then
+  -- Reset rounding drift whenever a tenant has the limit to itself.
+  total = weight
+  redis.call("SET", total_key, total)
+else
+  total = tonumber(redis.call("INCRBYFLOAT", total_key, weight - old))
+end
+local ttl = math.ceil(window)
+redis.call("EXPIRE", active_key, ttl)
+redis.call("EXPIRE", weights_key, ttl)
+redis.call("EXPIRE", total_key, ttl)
+
+local share = math.min(weight / total, 1)
+
+-- A share always fits one request that fits the global burst.
+local levels = {
+  {global_key, burst, rate},
+  {tenant_key, math.max(burst * share, math.min(cost, burst)), rate * share},
+}
+
+local results = {}
+local new_tats = {}
+local resets = {}
+local denied = false
+
+for i, level in ipairs(levels) do
+  local key, level_burst, level_rate = level[1], level[2], level[3]
+  local emission_interval = period / level_rate
+  local burst_offset = emission_interval * level_burst
+
+  local tat = redis.call("GET", key)
+  if not tat then
+    tat = now
+  else
+    tat = tonumber(tat)
+  end
+
+  if cost > level_burst then
+    denied = true
+    results[i] = {0, 0, "-1", tostring(tat - now), 2}
+  else
+    local new_tat = math.max(tat, now) + emission_interval * cost
+    local diff = now - (new_tat - burst_offset)
+    if diff < 0 then
+      denied = true
+      results[i] = {0, 0, tostring(diff * -1), tostring(tat - now), 1}
+    else
+      new_tats[i] = new_tat
+      resets[i] = tostring(math.max(tat - now, 0))
+      results[i] = {cost, math.floor(diff / emission_interval + 0.5), "-1", tostring(new_tat - now), 0}
+    end
+  end
+end
+
+local out = {}
+for i, level in ipairs(levels) do
+  local r = results[i]
+  if new_tats[i] then
+    if denied then
+      r[1] = 0
+      r[2] = r[2] + cost
+      r[4] = resets[i]
+    else
+      redis.call("SET", level[1], new_tats[i], "EX", math.ceil(new_tats[i] - now))
+    end
+  end
+  for _, v in ipairs(r) do
+    table.insert(out, v)
+  end
+end
+table.insert(out, tostring(share))
+table.insert(out, active)
+return out
 `
 
 // allowNScript is kept for radix users who want the preloaded script.
@@ -0,0 +1,98 @@
+package leakybucketgcra
+
+import "time"
+
+// Recorder receives measurements about limiter activity, for example to
+// export metrics. Implementations must be safe for concurrent use and should
+// return quickly since they run inline with every request.
+type Recorder interface {
+	// RecordDecision is called for every AllowN decision. name identifies the
+	// limit: the name given to AllowNamed, otherwise Limit.String of the
+	// limit passed to AllowN. AllowHierarchy uses the leaf level's limit,
+	// AllowFair the FairShare's and AllowQuota Quota.String.
+	RecordDecision(name string, limit Limit, cost int64, allowed bool)
+
+	// RecordScript is called after every Lua script execution.
+	RecordScript(elapsed time.Duration, err error)
+
+	// RecordError is called when a plain Redis command such as GET or DEL fails.
+	RecordError(command string, err error)
+
+	// RecordDegraded is called when a request is allowed without a decision
+	// from Redis because the Limiter is in fail-open mode.
+	RecordDegraded(name string)
+
+	// RecordDenyCacheHit is called when a request is denied from the local
+	// deny cache without running the script. RecordDecision is called too.
+	RecordDenyCacheHit(name string)
+}
+
+// WithRecorder registers r to receive measurements from the Limiter. It may
+// be used several times to feed multiple recorders.
+func WithRecorder(r Recorder) Option {
+	return func(l *Limiter) {
+		l.addRecorder(r)
+	}
+}
+
+func (l *Limiter) addRecorder(r Recorder) {
+	switch cur := l.rec.(type) {
+	case nopRecorder:
+		l.rec = r
+	case multiRecorder:
+		l.rec = append(cur, r)
+	default:
+		l.rec = multiRecorder{cur, r}
+	}
+}
+
+// WithFailOpen makes AllowN allow requests when Redis cannot be reached or
+// returns an unexpected response, instead of returning the error. Such
+// degraded results allow the full cost and carry no retry or reset hints.
+// Invalid limits are still rejected.
+func WithFailOpen() Option {
+	return func(l *Limiter) {
+		l.failOpen = true
+	}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) RecordDecision(string, Limit, int64, bool) {}
+func (nopRecorder) RecordScript(time.Duration, error)         {}
+func (nopRecorder) RecordError(string, error)                 {}
+func (nopRecorder) RecordDegraded(string)                     {}
+func (nopRecorder) RecordDenyCacheHit(string)                 {}
+
+// multiRecorder fans measurements out to several recorders.
+type multiRecorder []Recorder
+
+func (m multiRecorder) RecordDecision(name string, limit Limit, cost int64, allowed bool) {
+	for _, r := range m {
+		r.RecordDecision(name, limit, cost, allowed)
+	}
+}
+
+func (m multiRecorder) RecordScript(elapsed time.Duration, err error) {
+	for _, r := range m {
+		r.RecordScript(elapsed, err)
+	}
+}
+
+func (m multiRecorder) RecordError(command string, err error) {
+	for _, r := range m {
+		r.RecordError(command, err)
+	}
+}
+
+func (m multiRecorder) RecordDegraded(name string) {
+	for _, r := range m {
+		r.RecordDegraded(name)
+	}
+}
+
+func (m multiRecorder) RecordDenyCacheHit(name string) {
+	for _, r := range m {
+		r.RecordDenyCacheHit(name)
+	}
+}
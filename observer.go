@@ -0,0 +1,133 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Observer is notified of every AllowN decision, for example to audit
+// denials or feed abuse detection. res is nil when err is non-nil; limit is
+// the limit requested by the caller while res.Limit is the one enforced.
+// Observers registered with WithObserver run synchronously on the request
+// path; wrap slow observers with NewAsyncObserver.
+type Observer interface {
+	OnDecision(ctx context.Context, key string, limit Limit, cost int64, res *RateLimitResult, err error)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(ctx context.Context, key string, limit Limit, cost int64, res *RateLimitResult, err error)
+
+// OnDecision calls f.
+func (f ObserverFunc) OnDecision(ctx context.Context, key string, limit Limit, cost int64, res *RateLimitResult, err error) {
+	f(ctx, key, limit, cost, res, err)
+}
+
+// WithObserver registers o to be called after every AllowN decision.
+// Observers are called in registration order.
+func WithObserver(o Observer) Option {
+	return func(l *Limiter) {
+		l.observers = append(l.observers, o)
+	}
+}
+
+func (l Limiter) notify(ctx context.Context, key string, limit Limit, cost int64, res *RateLimitResult, err error) {
+	for _, o := range l.observers {
+		o.OnDecision(ctx, key, limit, cost, res, err)
+	}
+}
+
+// decision is a queued OnDecision call.
+type decision struct {
+	ctx   context.Context
+	key   string
+	limit Limit
+	cost  int64
+	res   *RateLimitResult
+	err   error
+}
+
+// AsyncObserver delivers decisions to another Observer from a background
+// goroutine through a bounded queue. When the queue is full, decisions are
+// dropped rather than slowing down the caller, and counted in Dropped.
+type AsyncObserver struct {
+	next    Observer
+	queue   chan decision
+	dropped atomic.Uint64
+	done    chan struct{}
+
+	mu     sync.RWMutex // guards closed and sends on queue
+	closed bool
+}
+
+// NewAsyncObserver starts a dispatcher delivering to o with room for size
+// pending decisions; a size below zero is treated as zero. Call Close to
+// flush the queue and stop it.
+func NewAsyncObserver(o Observer, size int) *AsyncObserver {
+	a := &AsyncObserver{
+		next:  o,
+		queue: make(chan decision, max(size, 0)),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// OnDecision implements Observer by enqueueing a copy of the decision, so
+// the caller may change res afterwards. The context passed on to the wrapped
+// Observer keeps ctx's values but not its cancellation.
+func (a *AsyncObserver) OnDecision(ctx context.Context, key string, limit Limit, cost int64, res *RateLimitResult, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.dropped.Add(1)
+		return
+	}
+	select {
+	case a.queue <- decision{context.WithoutCancel(ctx), key, limit, cost, copyResult(res), err}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of decisions discarded because the queue was
+// full or the dispatcher was closed.
+func (a *AsyncObserver) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close delivers the decisions already queued and stops the dispatcher.
+func (a *AsyncObserver) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
+
+// copyResult returns a deep copy of res.
+func copyResult(res *RateLimitResult) *RateLimitResult {
+	if res == nil {
+		return nil
+	}
+	c := *res
+	if c.RetryAfter != nil {
+		d := *c.RetryAfter
+		c.RetryAfter = &d
+	}
+	if c.ResetAfter != nil {
+		d := *c.ResetAfter
+		c.ResetAfter = &d
+	}
+	return &c
+}
+
+func (a *AsyncObserver) run() {
+	defer close(a.done)
+	for d := range a.queue {
+		a.next.OnDecision(d.ctx, d.key, d.limit, d.cost, d.res, d.err)
+	}
+}
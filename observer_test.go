@@ -0,0 +1,91 @@
+package leakybucketgcra_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestObserverSeesDecisions(t *testing.T) {
+	var denied []string
+	audit := gcra.ObserverFunc(func(ctx context.Context, key string, limit gcra.Limit, cost int64, res *gcra.RateLimitResult, err error) {
+		require.NoError(t, err)
+		if res.Allowed == 0 {
+			denied = append(denied, key)
+		}
+	})
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock, gcra.WithObserver(audit))
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Allow("user:42", gcra.PerSecond(1, 2))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"user:42"}, denied)
+}
+
+func TestAsyncObserverDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var (
+		mu   sync.Mutex
+		seen int
+	)
+	slow := gcra.ObserverFunc(func(context.Context, string, gcra.Limit, int64, *gcra.RateLimitResult, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		seen++
+		mu.Unlock()
+	})
+	async := gcra.NewAsyncObserver(slow, 2)
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock, gcra.WithObserver(async))
+
+	// One decision is held by the blocked observer and two fill the queue;
+	// the rest are dropped without blocking the caller.
+	for i := 0; i < 10; i++ {
+		_, err := limiter.Allow("user:42", gcra.PerSecond(100, 100))
+		require.NoError(t, err)
+		if i == 0 {
+			<-started
+		}
+	}
+	close(release)
+	require.NoError(t, async.Close())
+
+	assert.Equal(t, 3, seen)
+	assert.Equal(t, uint64(7), async.Dropped())
+}
+
+func TestAsyncObserverCopiesResults(t *testing.T) {
+	var got *gcra.RateLimitResult
+	record := gcra.ObserverFunc(func(_ context.Context, _ string, _ gcra.Limit, _ int64, res *gcra.RateLimitResult, _ error) {
+		got = res
+	})
+	async := gcra.NewAsyncObserver(record, -1)
+	async.Close()
+	assert.Equal(t, uint64(0), async.Dropped())
+
+	async = gcra.NewAsyncObserver(record, 1)
+	retry := time.Second
+	res := &gcra.RateLimitResult{Remaining: 3, RetryAfter: &retry}
+	async.OnDecision(context.Background(), "user:42", gcra.PerSecond(1, 1), 1, res, nil)
+	res.Remaining = 0
+	retry = time.Hour
+	require.NoError(t, async.Close())
+
+	require.NotNil(t, got)
+	assert.Equal(t, int64(3), got.Remaining)
+	assert.Equal(t, time.Second, *got.RetryAfter)
+}
@@ -0,0 +1,12 @@
+package leakybucketgcra
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithLimitProvider sets the provider used by AllowNamed and AllowNamedN to
+// resolve limits by name.
+func WithLimitProvider(p LimitProvider) Option {
+	return func(l *Limiter) {
+		l.limits = p
+	}
+}
@@ -0,0 +1,152 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package to OpenTelemetry.
+const instrumentationName = "github.com/sagarsuperuser/leaky-bucket-gcra"
+
+var (
+	attrKeyHash    = attribute.Key("gcra.key_hash")
+	attrLimit      = attribute.Key("gcra.limit")
+	attrCost       = attribute.Key("gcra.cost")
+	attrAllowed    = attribute.Key("gcra.allowed")
+	attrRemaining  = attribute.Key("gcra.remaining")
+	attrRetryAfter = attribute.Key("gcra.retry_after")
+	attrDecision   = attribute.Key("gcra.decision")
+	attrReason     = attribute.Key("gcra.reason")
+	attrCommand    = attribute.Key("db.operation.name")
+	attrDBSystem   = attribute.String("db.system.name", "redis")
+)
+
+// WithTracerProvider makes the Limiter record OpenTelemetry spans for
+// AllowN, Peek, Reset and script executions. Use the Context variants of
+// those methods to attach the spans to an existing trace. Keys are recorded
+// as an unsalted hash rather than verbatim; guessable keys can be recovered
+// from it.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(l *Limiter) {
+		l.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// WithMeterProvider makes the Limiter record OpenTelemetry metrics: request
+// counts by limit and decision, request cost, script latency, Redis errors,
+// fail-open decisions and active pool connections.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(l *Limiter) {
+		l.addRecorder(newOtelRecorder(mp.Meter(instrumentationName), l.rdb))
+	}
+}
+
+// hashKey returns a short, stable identifier for key so that telemetry can
+// correlate requests on a key without recording it verbatim. The hash is
+// unsalted, so keys drawn from a small space, such as "user:42", can be
+// recovered by hashing candidates: it offers correlation, not privacy.
+func hashKey(key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func keyHashAttr(key string) attribute.KeyValue {
+	return attrKeyHash.String(hashKey(key))
+}
+
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endAllowSpan annotates an AllowN span with the decision.
+func endAllowSpan(span trace.Span, res *RateLimitResult, err error) {
+	if err != nil {
+		spanError(span, err)
+		return
+	}
+	if !span.IsRecording() {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attrLimit.String(res.Limit.String()),
+		attrAllowed.Bool(res.Allowed > 0),
+		attrRemaining.Int64(res.Remaining),
+		attrReason.String(res.Reason.String()),
+	}
+	if res.RetryAfter != nil {
+		attrs = append(attrs, attrRetryAfter.Float64(res.RetryAfter.Seconds()))
+	}
+	span.SetAttributes(attrs...)
+}
+
+// otelRecorder is a Recorder backed by OpenTelemetry instruments.
+type otelRecorder struct {
+	requests metric.Int64Counter
+	cost     metric.Int64Histogram
+	script   metric.Float64Histogram
+	errors   metric.Int64Counter
+	degraded metric.Int64Counter
+	denyHits metric.Int64Counter
+}
+
+func newOtelRecorder(m metric.Meter, rdb Client) *otelRecorder {
+	r := &otelRecorder{}
+	r.requests, _ = m.Int64Counter("gcra.requests",
+		metric.WithDescription("Requests checked against the limiter, by limit and decision."))
+	r.cost, _ = m.Int64Histogram("gcra.request.cost",
+		metric.WithDescription("Cost of requests checked against the limiter."))
+	r.script, _ = m.Float64Histogram("gcra.script.duration",
+		metric.WithDescription("Latency of limiter Lua script executions."), metric.WithUnit("s"))
+	r.errors, _ = m.Int64Counter("gcra.redis.errors",
+		metric.WithDescription("Failed Redis calls."))
+	r.degraded, _ = m.Int64Counter("gcra.degraded",
+		metric.WithDescription("Requests allowed in fail-open mode without a Redis decision."))
+	r.denyHits, _ = m.Int64Counter("gcra.deny_cache.hits",
+		metric.WithDescription("Requests denied from the local deny cache without a Redis call."))
+	m.Int64ObservableGauge("gcra.pool.active_connections",
+		metric.WithDescription("Redis connections in use, or -1 if unknown."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(rdb.NumActiveConns()))
+			return nil
+		}))
+	return r
+}
+
+func (r *otelRecorder) RecordDecision(name string, limit Limit, cost int64, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	ctx := context.Background()
+	r.requests.Add(ctx, 1, metric.WithAttributes(attrLimit.String(name), attrDecision.String(decision)))
+	r.cost.Record(ctx, cost, metric.WithAttributes(attrLimit.String(name)))
+}
+
+func (r *otelRecorder) RecordScript(elapsed time.Duration, err error) {
+	ctx := context.Background()
+	r.script.Record(ctx, elapsed.Seconds())
+	if err != nil {
+		r.errors.Add(ctx, 1, metric.WithAttributes(attrCommand.String("EVALSHA")))
+	}
+}
+
+func (r *otelRecorder) RecordError(command string, err error) {
+	r.errors.Add(context.Background(), 1, metric.WithAttributes(attrCommand.String(command)))
+}
+
+func (r *otelRecorder) RecordDegraded(name string) {
+	r.degraded.Add(context.Background(), 1, metric.WithAttributes(attrLimit.String(name)))
+}
+
+func (r *otelRecorder) RecordDenyCacheHit(name string) {
+	r.denyHits.Add(context.Background(), 1, metric.WithAttributes(attrLimit.String(name)))
+}
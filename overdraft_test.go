@@ -0,0 +1,75 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestOverdraft(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	normal := gcra.PerSecond(10, 10)
+	retries := normal
+	retries.Overdraft = 5
+
+	res, err := limiter.AllowN("webhooks", normal, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// Retries borrow beyond the empty bucket and report the debt.
+	res, err = limiter.AllowN("webhooks", retries, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, int64(-3), res.Remaining)
+	assert.Equal(t, 1300*time.Millisecond, *res.ResetAfter)
+
+	res, err = limiter.AllowN("webhooks", retries, 3)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason, "only 2 more tokens may be borrowed")
+	assert.InDelta(t, 100*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+
+	// Normal requests wait until the debt is repaid.
+	res, err = limiter.Allow("webhooks", normal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.InDelta(t, 400*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+
+	clock.Advance(401 * time.Millisecond)
+	res, err = limiter.Allow("webhooks", normal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+}
+
+func TestOverdraftCostExceedsBurst(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	limit := gcra.Limit{Rate: 10, Burst: 10, Period: time.Second, Overdraft: 5}
+
+	res, err := limiter.AllowN("jobs", limit, 16)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonCostExceedsBurst, res.Reason)
+
+	res, err = limiter.AllowN("jobs", limit, 15)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), res.Allowed)
+	assert.Equal(t, int64(-5), res.Remaining)
+}
+
+func TestOverdraftValidation(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+
+	_, err := limiter.Allow("jobs", gcra.Limit{Rate: 10, Burst: 10, Period: time.Second, Overdraft: -1})
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.Allow("jobs", gcra.Limit{Rate: 10, Period: time.Second, Overdraft: 1, Algorithm: gcra.AlgorithmFixedWindow})
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowHierarchy([]gcra.Node{{"jobs", gcra.Limit{Rate: 10, Burst: 10, Period: time.Second, Overdraft: 1}}}, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+
+	assert.Equal(t, "10 req/s (burst 10, overdraft 5)", gcra.Limit{Rate: 10, Burst: 10, Period: time.Second, Overdraft: 5}.String())
+}
@@ -0,0 +1,213 @@
+package leakybucketgcra
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOverridesKey = "gcra:overrides"
+	defaultOverridesTTL = 5 * time.Second
+)
+
+// OverrideOptions configures per-tenant limit overrides. Overrides are stored
+// in a Redis hash mapping tenant to limit (in the Limit.String format), so
+// support staff can raise a single customer's limit without a deploy.
+type OverrideOptions struct {
+	// Key is the Redis hash holding the overrides. Defaults to "gcra:overrides".
+	Key string
+
+	// Channel is the pub/sub channel used to invalidate cached overrides on
+	// every instance. Defaults to Key + ":invalidate".
+	Channel string
+
+	// TTL is how long overrides (and their absence) are cached locally.
+	// Defaults to 5s. Without pub/sub support changes take up to TTL to apply.
+	TTL time.Duration
+
+	// TenantOf maps a rate limit key to its tenant. Defaults to the key itself.
+	TenantOf func(key string) string
+}
+
+// Subscriber is implemented by Clients that support Redis pub/sub. The
+// returned function cancels the subscription.
+type Subscriber interface {
+	Subscribe(channel string, fn func(message string)) (unsubscribe func() error, err error)
+}
+
+// WithOverrides makes the Limiter consult per-tenant overrides before the
+// limit passed to AllowN. Overrides are cached locally for opts.TTL and, when
+// the Client implements Subscriber, invalidated immediately through pub/sub.
+// If subscribing fails the cache relies on the TTL alone. A stored override
+// that does not parse fails its tenant's requests with an error wrapping
+// ErrInvalidLimit, even under WithFailOpen.
+func WithOverrides(opts OverrideOptions) Option {
+	return func(l *Limiter) {
+		if opts.Key == "" {
+			opts.Key = defaultOverridesKey
+		}
+		if opts.Channel == "" {
+			opts.Channel = opts.Key + ":invalidate"
+		}
+		if opts.TTL <= 0 {
+			opts.TTL = defaultOverridesTTL
+		}
+		if opts.TenantOf == nil {
+			opts.TenantOf = func(key string) string { return key }
+		}
+		o := &overrideStore{
+			rdb:   l.rdb,
+			opts:  opts,
+			cache: make(map[string]cachedOverride),
+		}
+		// Denials cached under the old limit no longer apply. The deny
+		// cache may be configured after this option.
+		o.onInvalidate = func(tenant string) {
+			if l.denials != nil {
+				l.denials.removeFunc(func(key string) bool { return opts.TenantOf(key) == tenant })
+			}
+		}
+		if sub, ok := l.rdb.(Subscriber); ok {
+			if unsubscribe, err := sub.Subscribe(opts.Channel, o.invalidate); err == nil {
+				l.closers = append(l.closers, unsubscribe)
+			}
+		}
+		l.overrides = o
+	}
+}
+
+var errOverridesDisabled = errors.New("overrides are not enabled; configure the Limiter with WithOverrides")
+
+// SetOverride stores limit as the override for tenant and notifies other
+// instances to drop their cached copy.
+func (l Limiter) SetOverride(tenant string, limit Limit) error {
+	if l.overrides == nil {
+		return errOverridesDisabled
+	}
+	if err := limit.validate(); err != nil {
+		return err
+	}
+	return l.overrides.set(tenant, limit)
+}
+
+// ClearOverride removes the override for tenant, restoring the default limit.
+func (l Limiter) ClearOverride(tenant string) error {
+	if l.overrides == nil {
+		return errOverridesDisabled
+	}
+	return l.overrides.clear(tenant)
+}
+
+// ListOverrides returns all stored overrides keyed by tenant.
+func (l Limiter) ListOverrides() (map[string]Limit, error) {
+	if l.overrides == nil {
+		return nil, errOverridesDisabled
+	}
+	return l.overrides.list()
+}
+
+type cachedOverride struct {
+	limit   Limit
+	found   bool
+	expires time.Time
+}
+
+// overrideStore reads overrides from Redis through a small TTL cache.
+type overrideStore struct {
+	rdb  Client
+	opts OverrideOptions
+
+	mu    sync.Mutex
+	cache map[string]cachedOverride
+	gen   uint64 // bumped by invalidate, so lookups racing it do not cache
+
+	onInvalidate func(tenant string)
+}
+
+// lookup returns the override for the tenant owning key, if any. A stored
+// override that does not parse is reported as an error wrapping
+// ErrInvalidLimit; other errors come from Redis.
+func (o *overrideStore) lookup(key string) (Limit, bool, error) {
+	tenant := o.opts.TenantOf(key)
+	now := time.Now()
+
+	o.mu.Lock()
+	c, ok := o.cache[tenant]
+	gen := o.gen
+	o.mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.limit, c.found, nil
+	}
+
+	var raw interface{}
+	if err := o.rdb.DoCmd(&raw, "HGET", o.opts.Key, tenant); err != nil {
+		return Limit{}, false, backendErr(err)
+	}
+	s, err := normalizeString(raw)
+	if err != nil {
+		return Limit{}, false, responseErr("parse override", err)
+	}
+	c = cachedOverride{expires: now.Add(o.opts.TTL)}
+	if s != "" {
+		if c.limit, err = ParseLimit(s); err != nil {
+			return Limit{}, false, fmt.Errorf("override for tenant %q: %w", tenant, err)
+		}
+		c.found = true
+	}
+
+	// An invalidation since the HGET may mean the value is already stale.
+	o.mu.Lock()
+	if o.gen == gen {
+		o.cache[tenant] = c
+	}
+	o.mu.Unlock()
+	return c.limit, c.found, nil
+}
+
+func (o *overrideStore) set(tenant string, limit Limit) error {
+	if err := o.rdb.DoCmd(nil, "HSET", o.opts.Key, tenant, limit.String()); err != nil {
+		return backendErr(err)
+	}
+	return o.publish(tenant)
+}
+
+func (o *overrideStore) clear(tenant string) error {
+	if err := o.rdb.DoCmd(nil, "HDEL", o.opts.Key, tenant); err != nil {
+		return backendErr(err)
+	}
+	return o.publish(tenant)
+}
+
+func (o *overrideStore) list() (map[string]Limit, error) {
+	raw := make(map[string]string)
+	if err := o.rdb.DoCmd(&raw, "HGETALL", o.opts.Key); err != nil {
+		return nil, backendErr(err)
+	}
+	out := make(map[string]Limit, len(raw))
+	for tenant, s := range raw {
+		limit, err := ParseLimit(s)
+		if err != nil {
+			return nil, fmt.Errorf("override for tenant %q: %w", tenant, err)
+		}
+		out[tenant] = limit
+	}
+	return out, nil
+}
+
+// publish drops the local cache entry and tells other instances to do the same.
+func (o *overrideStore) publish(tenant string) error {
+	o.invalidate(tenant)
+	return backendErr(o.rdb.DoCmd(nil, "PUBLISH", o.opts.Channel, tenant))
+}
+
+func (o *overrideStore) invalidate(tenant string) {
+	o.mu.Lock()
+	delete(o.cache, tenant)
+	o.gen++
+	o.mu.Unlock()
+	if o.onInvalidate != nil {
+		o.onInvalidate(tenant)
+	}
+}
@@ -0,0 +1,66 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+// racingClient runs afterHGET once, after the first HGET returns, to change
+// an override while a lookup is in flight.
+type racingClient struct {
+	gcra.Client
+	afterHGET func()
+}
+
+func (c *racingClient) DoCmd(rcv interface{}, cmd, key string, args ...interface{}) error {
+	err := c.Client.DoCmd(rcv, cmd, key, args...)
+	if cmd == "HGET" && c.afterHGET != nil {
+		fn := c.afterHGET
+		c.afterHGET = nil
+		fn()
+	}
+	return err
+}
+
+func (c *racingClient) Subscribe(channel string, fn func(message string)) (func() error, error) {
+	return c.Client.(gcra.Subscriber).Subscribe(channel, fn)
+}
+
+func TestOverrideInvalidatedDuringLookup(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	mock := testmock.NewMockClient(clock)
+	admin := gcra.NewLimiter(mock, gcra.WithOverrides(gcra.OverrideOptions{}))
+	client := &racingClient{Client: mock}
+	limiter := gcra.NewLimiter(client, gcra.WithOverrides(gcra.OverrideOptions{TTL: time.Hour}))
+	limit := gcra.PerSecond(1, 1)
+
+	client.afterHGET = func() {
+		require.NoError(t, admin.SetOverride("acme", gcra.PerSecond(10, 10)))
+	}
+	res, err := limiter.AllowN("acme", limit, 1)
+	require.NoError(t, err)
+	assert.Equal(t, limit, res.Limit)
+
+	// The lookup that raced the change did not cache the stale absence.
+	clock.Advance(time.Second)
+	res, err = limiter.AllowN("acme", limit, 5)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonOverridden, res.Reason)
+	assert.Equal(t, int64(5), res.Allowed)
+}
+
+func TestMalformedOverrideIsNotAnOutage(t *testing.T) {
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	require.NoError(t, mock.DoCmd(nil, "HSET", "gcra:overrides", "acme", "lots/day"))
+	limiter := gcra.NewLimiter(mock, gcra.WithOverrides(gcra.OverrideOptions{}), gcra.WithFailOpen())
+
+	_, err := limiter.Allow("acme", gcra.PerSecond(1, 1))
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	assert.NotErrorIs(t, err, gcra.ErrBackendUnavailable)
+}
@@ -0,0 +1,158 @@
+package leakybucketgcra
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// limitPattern matches "<rate>[r|req]/<period> [burst <n>] [overdraft <n>]
+// [algorithm]" in the forms accepted by ParseLimit, including the output of
+// Limit.String.
+var limitPattern = regexp.MustCompile(`^(\d+)\s*(?:r|req|reqs|requests?)?\s*/\s*([0-9a-zµ.]+)(?:\s*,?\s*\(?\s*burst\s*[=: ]?\s*(\d+)\s*\)?)?(?:\s*,?\s*\(?\s*overdraft\s*[=: ]?\s*(\d+)\s*\)?)?(?:\s*,?\s*\(?\s*([a-z][a-z_ -]*[a-z])\s*\)?)?$`)
+
+// periodUnits maps unit names accepted by ParseLimit to durations.
+var periodUnits = map[string]time.Duration{
+	"ms": time.Millisecond, "msec": time.Millisecond, "millisecond": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "wk": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour,
+}
+
+// ParseLimit parses a human-readable limit. It accepts the format produced by
+// Limit.String ("10 req/s (burst 20)") as well as shorter forms such as
+// "10/s burst 20", "10r/s", "1000/day" and "5/500ms". The period is either a
+// unit name (s, m, h, day, week, ...) optionally prefixed by a count ("2h",
+// "30day") or any value accepted by time.ParseDuration. When the burst is
+// omitted it defaults to the rate. An overdraft may follow the burst, as in
+// "10/s burst 20 overdraft 5". An algorithm name may follow, as in
+// "1000/h fixed_window"; windowed algorithms take no burst or overdraft.
+func ParseLimit(s string) (Limit, error) {
+	m := limitPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return Limit{}, fmt.Errorf("%w %q: expected <rate>/<period> [burst <n>] [overdraft <n>] [algorithm]", ErrInvalidLimit, s)
+	}
+	rate, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return Limit{}, fmt.Errorf("%w %q: rate: %w", ErrInvalidLimit, s, err)
+	}
+	period, err := parsePeriod(m[2])
+	if err != nil {
+		return Limit{}, fmt.Errorf("%w %q: %w", ErrInvalidLimit, s, err)
+	}
+	burst := rate
+	if m[3] != "" {
+		burst, err = strconv.ParseInt(m[3], 10, 64)
+		if err != nil {
+			return Limit{}, fmt.Errorf("%w %q: burst: %w", ErrInvalidLimit, s, err)
+		}
+	}
+	var overdraft int64
+	if m[4] != "" {
+		overdraft, err = strconv.ParseInt(m[4], 10, 64)
+		if err != nil {
+			return Limit{}, fmt.Errorf("%w %q: overdraft: %w", ErrInvalidLimit, s, err)
+		}
+	}
+	var algorithm Algorithm
+	if m[5] != "" {
+		if algorithm, err = parseAlgorithm(m[5]); err != nil {
+			return Limit{}, fmt.Errorf("%w %q: %w", ErrInvalidLimit, s, err)
+		}
+	}
+	if algorithm.windowed() {
+		if m[3] != "" {
+			return Limit{}, fmt.Errorf("%w %q: %s takes no burst", ErrInvalidLimit, s, algorithm)
+		}
+		burst = 0
+	}
+	l := Limit{Rate: rate, Burst: burst, Period: period, Algorithm: algorithm, Overdraft: overdraft}
+	if err := l.validate(); err != nil {
+		return Limit{}, err
+	}
+	return l, nil
+}
+
+func parsePeriod(s string) (time.Duration, error) {
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	count, unit := s[:digits], s[digits:]
+	d, ok := periodUnits[unit]
+	if !ok {
+		d, ok = periodUnits[strings.TrimSuffix(unit, "s")] // plurals such as "days"
+	}
+	if !ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+		return d, nil
+	}
+	if count != "" {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil || n <= 0 || n > math.MaxInt64/int64(d) {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+		d *= time.Duration(n)
+	}
+	return d, nil
+}
+
+// MarshalText implements encoding.TextMarshaler using the String format.
+// The zero Limit marshals to an empty string.
+func (l Limit) MarshalText() ([]byte, error) {
+	if l.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseLimit.
+// An empty string yields the zero Limit.
+func (l *Limit) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*l = Limit{}
+		return nil
+	}
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the limit as a string.
+func (l Limit) MarshalJSON() ([]byte, error) {
+	text, err := l.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts a string in any form
+// understood by ParseLimit; null leaves the limit unchanged.
+func (l *Limit) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("limit must be a JSON string: %w", err)
+	}
+	return l.UnmarshalText([]byte(s))
+}
+
+// Set implements flag.Value so limits can be passed as command line flags:
+//
+//	var limit = gcra.PerSecond(10, 20)
+//	flag.Var(&limit, "limit", "request limit, e.g. 10/s burst 20")
+func (l *Limit) Set(s string) error {
+	return l.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,72 @@
+package leakybucketgcra_test
+
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want gcra.Limit
+	}{
+		{"10/s", gcra.PerSecond(10, 10)},
+		{"10/s burst 20", gcra.PerSecond(10, 20)},
+		{"10r/s", gcra.PerSecond(10, 10)},
+		{"10 req/s (burst 20)", gcra.PerSecond(10, 20)},
+		{"100/m burst=5", gcra.PerMinute(100, 5)},
+		{"1000/day", gcra.PerDay(1000, 1000)},
+		{"1000/days", gcra.PerDay(1000, 1000)},
+		{"3/hour, burst 1", gcra.PerHour(3, 1)},
+		{"5/500ms", gcra.Limit{Rate: 5, Burst: 5, Period: 500 * time.Millisecond}},
+		{"7/2h burst 0", gcra.Limit{Rate: 7, Burst: 0, Period: 2 * time.Hour}},
+		{"1/1m30s", gcra.Limit{Rate: 1, Burst: 1, Period: 90 * time.Second}},
+		{"50/week", gcra.Limit{Rate: 50, Burst: 50, Period: 7 * 24 * time.Hour}},
+		{"10/s burst 20 overdraft 5", gcra.Limit{Rate: 10, Burst: 20, Period: time.Second, Overdraft: 5}},
+		{"10 req/s (burst 20, overdraft 5)", gcra.Limit{Rate: 10, Burst: 20, Period: time.Second, Overdraft: 5}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := gcra.ParseLimit(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+
+			roundTrip, err := gcra.ParseLimit(got.String())
+			require.NoError(t, err)
+			assert.Equal(t, got, roundTrip, got.String())
+		})
+	}
+
+	for _, in := range []string{"", "10", "ten/s", "0/s", "10/0s", "10/fortnight", "10/s burst -1", "10/s burst", "10/s overdraft", "10/h overdraft 5 fixed_window", "10/99999999999day"} {
+		_, err := gcra.ParseLimit(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestLimitEncoding(t *testing.T) {
+	type config struct {
+		API    gcra.Limit `json:"api"`
+		Unused gcra.Limit `json:"unused"`
+	}
+	data, err := json.Marshal(config{API: gcra.PerMinute(60, 300)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"api":"60 req/m (burst 300)","unused":""}`, string(data))
+
+	var cfg config
+	require.NoError(t, json.Unmarshal([]byte(`{"api":"5/500ms burst 2"}`), &cfg))
+	assert.Equal(t, gcra.Limit{Rate: 5, Burst: 2, Period: 500 * time.Millisecond}, cfg.API)
+	assert.Error(t, json.Unmarshal([]byte(`{"api":5}`), &cfg))
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	limit := gcra.PerSecond(1, 1)
+	fs.Var(&limit, "limit", "request limit")
+	require.NoError(t, fs.Parse([]string{"-limit", "100/h burst 10"}))
+	assert.Equal(t, gcra.PerHour(100, 10), limit)
+}
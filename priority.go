@@ -0,0 +1,95 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+)
+
+// Priority ranks requests sharing a bucket; higher values rank higher. When
+// capacity runs low, lower priorities are denied first so that higher ones
+// keep flowing. The zero value is PriorityNormal. Values above
+// PriorityCritical are treated as critical, and values below
+// PriorityBestEffort as best-effort.
+type Priority int
+
+const (
+	// PriorityBestEffort is shed first.
+	PriorityBestEffort Priority = iota - 1
+
+	// PriorityNormal is the priority of AllowN.
+	PriorityNormal
+
+	// PriorityCritical may use the whole bucket.
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBestEffort:
+		return "best_effort"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+// PriorityReserves sets the share of each bucket held back from lower
+// priorities, as fractions of Burst between 0 and 1. A request is denied
+// with ReasonReserved when granting it would leave less than its priority's
+// reserve. Critical requests have no reserve.
+type PriorityReserves struct {
+	// Normal is kept back from PriorityNormal requests, and so is only
+	// available to critical ones.
+	Normal float64
+
+	// BestEffort is kept back from PriorityBestEffort requests. It is
+	// raised to Normal if lower, so best-effort traffic is always shed
+	// first.
+	BestEffort float64
+}
+
+// WithPriorityReserves enables priority reserves for GCRA limits. The
+// reserve is enforced inside the script, so it holds across all processes
+// sharing the bucket. Without this option every priority may use the whole
+// bucket. Requests with a reserve bypass leasing and coalescing.
+func WithPriorityReserves(r PriorityReserves) Option {
+	return func(l *Limiter) {
+		l.reserves = r.normalized()
+	}
+}
+
+// AllowNPriority is like AllowN, but denies the request when it would eat
+// into the reserve that WithPriorityReserves sets aside for priorities above
+// p.
+func (l Limiter) AllowNPriority(key string, limit Limit, n int64, p Priority) (*RateLimitResult, error) {
+	return l.allowN(context.Background(), "", key, limit, n, allowOpts{priority: p})
+}
+
+// AllowNPriorityContext is like AllowNPriority, tracing the call as a child
+// of ctx.
+func (l Limiter) AllowNPriorityContext(ctx context.Context, key string, limit Limit, n int64, p Priority) (*RateLimitResult, error) {
+	return l.allowN(ctx, "", key, limit, n, allowOpts{priority: p})
+}
+
+// normalized clamps the reserves to [0, 1] and raises BestEffort to Normal.
+func (r PriorityReserves) normalized() PriorityReserves {
+	r.Normal = min(max(r.Normal, 0), 1)
+	r.BestEffort = min(max(r.BestEffort, r.Normal), 1)
+	return r
+}
+
+// tokens returns the tokens of limit held back from priority p. Priorities
+// outside the constants are clamped by rank to the nearest one.
+func (r PriorityReserves) tokens(limit Limit, p Priority) float64 {
+	switch {
+	case limit.Algorithm.windowed(), p >= PriorityCritical:
+		return 0
+	case p == PriorityNormal:
+		return r.Normal * float64(limit.Burst)
+	default:
+		return r.BestEffort * float64(limit.Burst)
+	}
+}
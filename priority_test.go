@@ -0,0 +1,127 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestPriorityReserves(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock),
+		gcra.WithPriorityReserves(gcra.PriorityReserves{Normal: 0.2, BestEffort: 0.5}))
+	limit := gcra.PerSecond(10, 10)
+
+	// Best effort may use half the bucket. Remaining counts what is left
+	// for the request's priority.
+	res, err := limiter.AllowNPriority("api", limit, 5, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	res, err = limiter.AllowNPriority("api", limit, 1, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, gcra.ReasonReserved, res.Reason)
+	assert.ErrorIs(t, res.Err(), gcra.ErrLimited)
+	assert.InDelta(t, 100*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+
+	// Normal traffic, including AllowN, may go down to a fifth.
+	res, err = limiter.AllowN("api", limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	res, err = limiter.Allow("api", limit)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonReserved, res.Reason)
+
+	// Critical traffic may empty the bucket.
+	res, err = limiter.AllowNPriority("api", limit, 2, gcra.PriorityCritical)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	res, err = limiter.AllowNPriority("api", limit, 1, gcra.PriorityCritical)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.InDelta(t, 100*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+
+	// Best effort waits for half the bucket to refill.
+	res, err = limiter.AllowNPriority("api", limit, 1, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.InDelta(t, 600*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+}
+
+func TestPriorityReserveExceedsCost(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))),
+		gcra.WithPriorityReserves(gcra.PriorityReserves{BestEffort: 0.5}))
+	limit := gcra.PerSecond(10, 10)
+
+	res, err := limiter.AllowNPriority("api", limit, 6, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonReserved, res.Reason)
+	assert.Nil(t, res.RetryAfter)
+
+	res, err = limiter.AllowNPriority("api", limit, 6, gcra.PriorityNormal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), res.Allowed)
+}
+
+func TestPrioritiesClampByRank(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))),
+		gcra.WithPriorityReserves(gcra.PriorityReserves{BestEffort: 0.5}))
+	limit := gcra.PerSecond(10, 10)
+
+	res, err := limiter.AllowNPriority("low", limit, 6, gcra.PriorityBestEffort-1)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonReserved, res.Reason)
+
+	res, err = limiter.AllowNPriority("high", limit, 10, gcra.PriorityCritical+1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Allowed)
+
+	assert.Less(t, gcra.PriorityBestEffort, gcra.PriorityNormal)
+	assert.Less(t, gcra.PriorityNormal, gcra.PriorityCritical)
+}
+
+func TestPriorityWithoutReserves(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	limit := gcra.PerSecond(2, 2)
+
+	res, err := limiter.AllowNPriority("api", limit, 2, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+}
+
+func TestPriorityDenyCache(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	rdb := &countingClient{Client: testmock.NewMockClient(clock)}
+	limiter := gcra.NewLimiter(rdb, gcra.WithDenyCache(10), gcra.WithClock(clock.Now),
+		gcra.WithPriorityReserves(gcra.PriorityReserves{BestEffort: 0.5}))
+	limit := gcra.PerSecond(2, 2)
+
+	limiter.AllowNPriority("api", limit, 2, gcra.PriorityCritical)
+	res, err := limiter.AllowNPriority("api", limit, 1, gcra.PriorityBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, gcra.ReasonRateExceeded, res.Reason)
+	assert.Equal(t, 2, rdb.evals)
+
+	// A best-effort denial says nothing about critical requests.
+	clock.Advance(500 * time.Millisecond)
+	res, err = limiter.AllowNPriority("api", limit, 1, gcra.PriorityCritical)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Allowed)
+	assert.Equal(t, 3, rdb.evals)
+}
+
+func TestPriorityString(t *testing.T) {
+	assert.Equal(t, "best_effort", gcra.PriorityBestEffort.String())
+	assert.Equal(t, "normal", gcra.Priority(0).String())
+	assert.Equal(t, "Priority(7)", gcra.Priority(7).String())
+	assert.Equal(t, "reserved", gcra.ReasonReserved.String())
+}
@@ -0,0 +1,55 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+)
+
+// LimitProvider resolves limits by name so they can be changed without
+// redeploying code, for example from a configuration file.
+// Implementations must be safe for concurrent use.
+type LimitProvider interface {
+	// Limit returns the limit registered under name, or false if none exists.
+	Limit(name string) (Limit, bool)
+}
+
+// StaticLimits is a LimitProvider backed by a fixed map.
+type StaticLimits map[string]Limit
+
+// Limit implements LimitProvider.
+func (s StaticLimits) Limit(name string) (Limit, bool) {
+	l, ok := s[name]
+	return l, ok
+}
+
+// AllowNamed is a shortcut for AllowNamedN with cost 1.
+func (l Limiter) AllowNamed(key, name string) (*RateLimitResult, error) {
+	return l.AllowNamedN(key, name, 1)
+}
+
+// AllowNamedN is like AllowN but resolves the limit by name from the
+// Limiter's LimitProvider at call time, so configuration changes apply
+// without restarting.
+func (l Limiter) AllowNamedN(key, name string, n int64) (*RateLimitResult, error) {
+	return l.AllowNamedNContext(context.Background(), key, name, n)
+}
+
+// AllowNamedNContext is like AllowNamedN, tracing the call as a child of ctx.
+func (l Limiter) AllowNamedNContext(ctx context.Context, key, name string, n int64) (*RateLimitResult, error) {
+	limit, err := l.resolveLimit(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.allowN(ctx, name, key, limit, n, allowOpts{})
+}
+
+func (l Limiter) resolveLimit(name string) (Limit, error) {
+	if l.limits == nil {
+		return Limit{}, fmt.Errorf("%w %q: no LimitProvider configured", ErrUnknownLimit, name)
+	}
+	limit, ok := l.limits.Limit(name)
+	if !ok {
+		return Limit{}, fmt.Errorf("%w %q", ErrUnknownLimit, name)
+	}
+	return limit, nil
+}
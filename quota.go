@@ -0,0 +1,224 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QuotaInterval is the calendar period a Quota resets on.
+type QuotaInterval int
+
+const (
+	// QuotaDaily resets at midnight.
+	QuotaDaily QuotaInterval = iota + 1
+	// QuotaWeekly resets at midnight on Monday.
+	QuotaWeekly
+	// QuotaMonthly resets at midnight on the 1st of the month.
+	QuotaMonthly
+)
+
+func (i QuotaInterval) String() string {
+	switch i {
+	case QuotaDaily:
+		return "day"
+	case QuotaWeekly:
+		return "week"
+	case QuotaMonthly:
+		return "month"
+	}
+	return fmt.Sprintf("QuotaInterval(%d)", int(i))
+}
+
+// Quota allows Limit units per calendar day, week or month in Location.
+// Unlike PerDay, which is a rolling 24h GCRA limit, a quota resets at a
+// fixed boundary, such as midnight in the customer's timezone, and all of
+// it is available again from then on.
+type Quota struct {
+	Limit    int64
+	Interval QuotaInterval
+	Location *time.Location // defaults to UTC
+}
+
+// Daily returns a Quota of limit per day, resetting at midnight in loc.
+func Daily(limit int64, loc *time.Location) Quota {
+	return Quota{Limit: limit, Interval: QuotaDaily, Location: loc}
+}
+
+// Weekly returns a Quota of limit per week, resetting at midnight on Monday
+// in loc.
+func Weekly(limit int64, loc *time.Location) Quota {
+	return Quota{Limit: limit, Interval: QuotaWeekly, Location: loc}
+}
+
+// Monthly returns a Quota of limit per month, resetting at midnight on the
+// 1st in loc.
+func Monthly(limit int64, loc *time.Location) Quota {
+	return Quota{Limit: limit, Interval: QuotaMonthly, Location: loc}
+}
+
+// String formats the quota as "1000/day (Europe/Paris)".
+func (q Quota) String() string {
+	return fmt.Sprintf("%d/%s (%s)", q.Limit, q.Interval, q.location())
+}
+
+func (q Quota) location() *time.Location {
+	if q.Location == nil {
+		return time.UTC
+	}
+	return q.Location
+}
+
+// Bounds returns the start and end of the period containing t.
+func (q Quota) Bounds(t time.Time) (start, end time.Time) {
+	loc := q.location()
+	y, m, d := t.In(loc).Date()
+	switch q.Interval {
+	case QuotaWeekly:
+		d -= (int(t.In(loc).Weekday()) + 6) % 7 // days since Monday
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+7, 0, 0, 0, 0, loc)
+	case QuotaMonthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	}
+}
+
+func (q Quota) validate() error {
+	if q.Limit <= 0 {
+		return fmt.Errorf("%w: quota %s: Limit must be greater than zero", ErrInvalidLimit, q)
+	}
+	if q.Interval < QuotaDaily || q.Interval > QuotaMonthly {
+		return fmt.Errorf("%w: quota %s: unknown interval", ErrInvalidLimit, q)
+	}
+	return nil
+}
+
+// QuotaResult reports a quota decision.
+type QuotaResult struct {
+	Quota Quota
+
+	// Allowed is the number of units granted (0 when the quota is exhausted).
+	Allowed int64
+
+	// Used and Remaining are the units consumed and left in the current
+	// period, after this request.
+	Used      int64
+	Remaining int64
+
+	// ResetAt is when the current period ends and the quota is restored.
+	ResetAt time.Time
+}
+
+// AllowQuota consumes n units of quota q for key if they are available in
+// the current period. An n of 0 reports usage without consuming anything.
+// Periods are computed with the Limiter's clock, so instances should keep
+// their clocks in sync. Decisions are reported to the Recorder under
+// q.String(), and to observers, the logger and hot key tracking as a
+// fixed-window Limit spanning the current period.
+func (l Limiter) AllowQuota(key string, q Quota, n int64) (*QuotaResult, error) {
+	return l.AllowQuotaContext(context.Background(), key, q, n)
+}
+
+// AllowQuotaContext is like AllowQuota, tracing the call as a child of ctx.
+func (l Limiter) AllowQuotaContext(ctx context.Context, key string, q Quota, n int64) (*QuotaResult, error) {
+	ctx, span := l.tracer.Start(ctx, "gcra.AllowQuota", trace.WithAttributes(keyHashAttr(key), attrCost.Int64(n)))
+	defer span.End()
+
+	res, err := l.allowQuota(ctx, key, q, n)
+	if err != nil {
+		spanError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attrAllowed.Bool(res.Allowed > 0), attrRemaining.Int64(res.Remaining))
+	return res, nil
+}
+
+func (l Limiter) allowQuota(ctx context.Context, key string, q Quota, n int64) (*QuotaResult, error) {
+	now := l.now()
+	start, end := q.Bounds(now)
+	limit := Limit{Rate: q.Limit, Period: end.Sub(start), Algorithm: AlgorithmFixedWindow}
+
+	res, granted, err := l.runQuota(ctx, key, q, n, start, end)
+	if err != nil {
+		l.report(ctx, key, limit, n, nil, err)
+		return nil, err
+	}
+	l.rec.RecordDecision(q.String(), limit, n, granted)
+	l.report(ctx, key, limit, n, res.decision(limit, n, granted, now), nil)
+	return res, nil
+}
+
+// runQuota runs the quota script and reports whether the request was granted.
+func (l Limiter) runQuota(ctx context.Context, key string, q Quota, n int64, start, end time.Time) (*QuotaResult, bool, error) {
+	if err := q.validate(); err != nil {
+		return nil, false, err
+	}
+
+	var resp []interface{}
+	err := l.evalScript(ctx, &resp, quotaScriptSrc, []string{quotaKey(key, q, start)},
+		strconv.FormatInt(q.Limit, 10),
+		strconv.FormatInt(n, 10),
+		strconv.FormatInt(end.UnixMilli(), 10),
+	)
+	if err != nil {
+		l.log.backendError(ctx, "quota", key, nil, err, false)
+		return nil, false, err
+	}
+	if len(resp) != 2 {
+		return nil, false, fmt.Errorf("%w: got %d items, want 2", ErrUnexpectedResponse, len(resp))
+	}
+	allowed, err := strconv.ParseInt(fmt.Sprint(resp[0]), 10, 64)
+	if err != nil {
+		return nil, false, responseErr("parse allowed", err)
+	}
+	used, err := strconv.ParseInt(fmt.Sprint(resp[1]), 10, 64)
+	if err != nil {
+		return nil, false, responseErr("parse used", err)
+	}
+
+	res := &QuotaResult{Quota: q, Used: used, Remaining: max(q.Limit-used, 0), ResetAt: end}
+	if allowed == 1 {
+		res.Allowed = n
+	}
+	return res, allowed == 1, nil
+}
+
+// decision describes r as a RateLimitResult under limit, for observers and
+// logs.
+func (r *QuotaResult) decision(limit Limit, n int64, granted bool, now time.Time) *RateLimitResult {
+	resetAfter := r.ResetAt.Sub(now)
+	out := &RateLimitResult{Limit: limit, Allowed: r.Allowed, Remaining: r.Remaining, ResetAfter: &resetAfter}
+	switch {
+	case granted:
+		out.Reason = ReasonAllowed
+	case n > r.Quota.Limit:
+		out.Reason = ReasonCostExceedsBurst
+	default:
+		out.Reason = ReasonRateExceeded
+		out.RetryAfter = &resetAfter
+	}
+	return out
+}
+
+// ResetQuota clears the usage of quota q for key in the current period.
+func (l Limiter) ResetQuota(key string, q Quota) error {
+	start, _ := q.Bounds(l.now())
+	if err := l.rdb.DoCmd(nil, "DEL", quotaKey(key, q, start)); err != nil {
+		err = backendErr(err)
+		l.rec.RecordError("DEL", err)
+		return err
+	}
+	return nil
+}
+
+// quotaKey names the counter of the period starting at start. Each period
+// has its own key, so a new period starts from zero even if the previous
+// counter has not expired yet. The start is written as a UTC instant, so
+// quotas on the same key in different timezones do not share a counter.
+func quotaKey(key string, q Quota, start time.Time) string {
+	return redisPrefix + key + ":quota:" + q.Interval.String() + ":" + start.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,142 @@
+package leakybucketgcra_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestQuotaBounds(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	// Saturday 2026-03-28 23:30 UTC is Sunday 00:30 in Paris, hours before
+	// the switch to summer time.
+	at := time.Date(2026, 3, 28, 23, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		quota      gcra.Quota
+		start, end time.Time
+	}{
+		{gcra.Daily(10, paris), time.Date(2026, 3, 29, 0, 0, 0, 0, paris), time.Date(2026, 3, 30, 0, 0, 0, 0, paris)},
+		{gcra.Daily(10, nil), time.Date(2026, 3, 28, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)},
+		{gcra.Weekly(10, paris), time.Date(2026, 3, 23, 0, 0, 0, 0, paris), time.Date(2026, 3, 30, 0, 0, 0, 0, paris)},
+		{gcra.Monthly(10, paris), time.Date(2026, 3, 1, 0, 0, 0, 0, paris), time.Date(2026, 4, 1, 0, 0, 0, 0, paris)},
+		{gcra.Monthly(10, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		start, end := tc.quota.Bounds(at)
+		assert.True(t, tc.start.Equal(start), "%s: start %s, want %s", tc.quota, start, tc.start)
+		assert.True(t, tc.end.Equal(end), "%s: end %s, want %s", tc.quota, end, tc.end)
+	}
+
+	// The day of the switch to summer time is 23 hours long.
+	start, end := gcra.Daily(10, paris).Bounds(at)
+	assert.Equal(t, 23*time.Hour, end.Sub(start))
+}
+
+func TestAllowQuota(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	clock := testmock.NewTestTime(time.Date(2026, 5, 31, 23, 0, 0, 0, ny))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now))
+	quota := gcra.Monthly(100, ny)
+
+	res, err := limiter.AllowQuota("acme", quota, 60)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), res.Allowed)
+	assert.Equal(t, int64(60), res.Used)
+	assert.Equal(t, int64(40), res.Remaining)
+	assert.True(t, time.Date(2026, 6, 1, 0, 0, 0, 0, ny).Equal(res.ResetAt))
+
+	res, err = limiter.AllowQuota("acme", quota, 50)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, int64(60), res.Used)
+
+	res, err = limiter.AllowQuota("acme", quota, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), res.Remaining)
+
+	// A new month starts from zero.
+	clock.Advance(time.Hour)
+	res, err = limiter.AllowQuota("acme", quota, 50)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), res.Allowed)
+	assert.Equal(t, int64(50), res.Remaining)
+	assert.True(t, time.Date(2026, 7, 1, 0, 0, 0, 0, ny).Equal(res.ResetAt))
+
+	require.NoError(t, limiter.ResetQuota("acme", quota))
+	res, err = limiter.AllowQuota("acme", quota, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Used)
+}
+
+func TestQuotaTimezonesDoNotShareCounters(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	clock := testmock.NewTestTime(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now))
+
+	res, err := limiter.AllowQuota("acme", gcra.Daily(10, time.UTC), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Allowed)
+
+	// Same date in Paris, but a different day.
+	res, err = limiter.AllowQuota("acme", gcra.Daily(10, paris), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Allowed)
+}
+
+func TestQuotaValidation(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	_, err := limiter.AllowQuota("acme", gcra.Daily(0, nil), 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	_, err = limiter.AllowQuota("acme", gcra.Quota{Limit: 1}, 1)
+	assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+}
+
+func TestQuotaDecisionsReachObservers(t *testing.T) {
+	var reasons []gcra.Reason
+	var limits []gcra.Limit
+	audit := gcra.ObserverFunc(func(_ context.Context, key string, limit gcra.Limit, _ int64, res *gcra.RateLimitResult, err error) {
+		require.NoError(t, err)
+		assert.Equal(t, "acme", key)
+		reasons = append(reasons, res.Reason)
+		limits = append(limits, limit)
+	})
+	clock := testmock.NewTestTime(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now), gcra.WithObserver(audit))
+	quota := gcra.Daily(10, nil)
+
+	for _, n := range []int64{10, 1, 11} {
+		_, err := limiter.AllowQuota("acme", quota, n)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []gcra.Reason{gcra.ReasonAllowed, gcra.ReasonRateExceeded, gcra.ReasonCostExceedsBurst}, reasons)
+	want := gcra.Limit{Rate: 10, Period: 24 * time.Hour, Algorithm: gcra.AlgorithmFixedWindow}
+	for _, limit := range limits {
+		assert.Equal(t, want, limit)
+	}
+}
+
+func TestQuotaDecisionsReachHotKeys(t *testing.T) {
+	clock := testmock.NewTestTime(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock), gcra.WithClock(clock.Now),
+		gcra.WithHotKeys(gcra.HotKeyOptions{}))
+	quota := gcra.Daily(1, nil)
+
+	// Reading usage is not a denial.
+	for _, n := range []int64{1, 0, 1} {
+		_, err := limiter.AllowQuota("acme", quota, n)
+		require.NoError(t, err)
+	}
+	report := limiter.HotKeys()
+	require.Len(t, report.ByRequests, 1)
+	require.Len(t, report.ByDenials, 1)
+	assert.InDelta(t, 1.0/3, report.ByDenials[0].Rate/report.ByRequests[0].Rate, 0.01)
+}
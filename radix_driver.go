@@ -1,7 +1,11 @@
 package leakybucketgcra
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
 )
 
 // Client matches the redis Client interface from the https://github.com/envoyproxy/ratelimit/blob/main/src/redis/driver.go
@@ -21,6 +25,8 @@ type Pipeline []radix.CmdAction
 // RadixClient is a concrete implementation backed by a radix Client (pool/cluster/sentinel).
 type RadixClient struct {
 	client             radix.Client
+	network, addr      string
+	connFunc           radix.ConnFunc // dials the pool and Subscribe
 	poolSize           int
 	implicitPipelining bool
 }
@@ -29,13 +35,31 @@ type RadixClient struct {
 // It's implementation executes Lua script that uses redis.replicate_commands,
 // so Redis 3.2+ is required. When implicitPipelining is true PipeDo executes
 // commands sequentially; when false PipeDo issues a single pipeline round-trip.
+// Connections are dialed with radix's defaults; use NewRadixClientWithConnFunc
+// when Redis requires AUTH, TLS or a database other than 0.
 func NewRadixClient(network, addr string, size int, implicitPipelining bool, opts ...radix.PoolOpt) (*RadixClient, error) {
+	return NewRadixClientWithConnFunc(network, addr, size, implicitPipelining, nil, opts...)
+}
+
+// NewRadixClientWithConnFunc is like NewRadixClient, but dials every
+// connection, those of the pool and the dedicated one of Subscribe, with
+// connFunc. A nil connFunc uses radix.DefaultConnFunc. connFunc replaces any
+// radix.PoolConnFunc among opts.
+func NewRadixClientWithConnFunc(network, addr string, size int, implicitPipelining bool, connFunc radix.ConnFunc, opts ...radix.PoolOpt) (*RadixClient, error) {
+	if connFunc == nil {
+		connFunc = radix.DefaultConnFunc
+	} else {
+		opts = append(opts, radix.PoolConnFunc(connFunc))
+	}
 	pool, err := radix.NewPool(network, addr, size, opts...)
 	if err != nil {
-		return nil, err
+		return nil, wrapRadixErr(err)
 	}
 	return &RadixClient{
 		client:   pool,
+		network:  network,
+		addr:     addr,
+		connFunc: connFunc,
 		poolSize: size,
 		// implicitPipelining can be set to true to let PipeDo execute each command sequentially,
 		// executing pipelines implicitly with default radix behavior.
@@ -45,14 +69,14 @@ func NewRadixClient(network, addr string, size int, implicitPipelining bool, opt
 
 // DoCmd executes a single redis command.
 func (c *RadixClient) DoCmd(rcv interface{}, cmd, key string, args ...interface{}) error {
-	return c.client.Do(radix.FlatCmd(rcv, cmd, key, args...))
+	return wrapRadixErr(c.client.Do(radix.FlatCmd(rcv, cmd, key, args...)))
 }
 
 // EvalScript executes a Lua script with one or more keys.
 func (c *RadixClient) EvalScript(rcv interface{}, script string, keys []string, args ...interface{}) error {
 	// Use EvalScript for SHA/caching; it will handle SCRIPT LOAD/EVALSHA.
 	es := radix.NewEvalScript(len(keys), script)
-	return c.client.Do(es.FlatCmd(rcv, keys, args...))
+	return wrapRadixErr(c.client.Do(es.FlatCmd(rcv, keys, args...)))
 }
 
 // PipeAppend appends a command onto the pipeline queue.
@@ -66,12 +90,44 @@ func (c *RadixClient) PipeDo(pipeline Pipeline) error {
 	if c.implicitPipelining {
 		for _, action := range pipeline {
 			if err := c.client.Do(action); err != nil {
-				return err
+				return wrapRadixErr(err)
 			}
 		}
 		return nil
 	}
-	return c.client.Do(radix.Pipeline(pipeline...))
+	return wrapRadixErr(c.client.Do(radix.Pipeline(pipeline...)))
+}
+
+// Subscribe delivers messages published on channel to fn. It opens a
+// dedicated connection, dialed like the pool's, that reconnects and
+// resubscribes automatically; call the returned function to close it.
+func (c *RadixClient) Subscribe(channel string, fn func(message string)) (func() error, error) {
+	ps, err := radix.PersistentPubSubWithOpts(c.network, c.addr, radix.PersistentPubSubConnFunc(c.connFunc))
+	if err != nil {
+		return nil, wrapRadixErr(err)
+	}
+	msgCh := make(chan radix.PubSubMessage, 64)
+	if err := ps.Subscribe(msgCh, channel); err != nil {
+		ps.Close()
+		return nil, wrapRadixErr(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case m := <-msgCh:
+				fn(string(m.Message))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() error {
+		// msgCh must keep being drained until Close returns.
+		err := ps.Close()
+		close(done)
+		return err
+	}, nil
 }
 
 // Close shuts down the underlying client.
@@ -99,3 +155,17 @@ func (c *RadixClient) NumActiveConns() int {
 func (c *RadixClient) ImplicitPipeliningEnabled() bool {
 	return c.implicitPipelining
 }
+
+// wrapRadixErr classifies radix errors: error replies from Redis wrap
+// ErrUnexpectedResponse, anything else (dial, I/O, timeouts) wraps
+// ErrBackendUnavailable.
+func wrapRadixErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var replyErr resp2.Error
+	if errors.As(err, &replyErr) {
+		return fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
@@ -0,0 +1,40 @@
+package leakybucketgcra
+
+// Reason explains a limiter decision.
+type Reason int
+
+const (
+	// ReasonAllowed means the request fit within the limit.
+	ReasonAllowed Reason = iota
+	// ReasonRateExceeded means the request was denied because the bucket
+	// lacks enough capacity right now; RetryAfter says when it will.
+	ReasonRateExceeded
+	// ReasonCostExceedsBurst means the request costs more than the burst and
+	// can never be allowed, for example to answer 413 rather than 429.
+	ReasonCostExceedsBurst
+	// ReasonDegraded means the request was allowed without a decision from
+	// Redis because the Limiter fails open.
+	ReasonDegraded
+	// ReasonOverridden means the request was allowed under a per-tenant
+	// override rather than the requested limit.
+	ReasonOverridden
+	// ReasonReserved means the bucket had room, but only in the share
+	// reserved for higher priorities.
+	ReasonReserved
+)
+
+var reasonNames = [...]string{
+	ReasonAllowed:          "allowed",
+	ReasonRateExceeded:     "rate_exceeded",
+	ReasonCostExceedsBurst: "cost_exceeds_burst",
+	ReasonDegraded:         "degraded",
+	ReasonOverridden:       "overridden",
+	ReasonReserved:         "reserved",
+}
+
+func (r Reason) String() string {
+	if r >= 0 && int(r) < len(reasonNames) {
+		return reasonNames[r]
+	}
+	return "unknown"
+}
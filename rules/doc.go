@@ -0,0 +1,21 @@
+// Package rules loads declarative rate limit rules from YAML or JSON and
+// matches them against request attributes.
+//
+// A rules file looks like:
+//
+//	defaults:
+//	  key: "ip:{ip}"
+//	  limit: "10/s burst 20"
+//	rules:
+//	  - name: free-api
+//	    match: {route: "/api/*", tier: "free"}
+//	    limit: "100/m burst 20"
+//	    key: "tenant:{tenant}"
+//	    priority: 10
+//
+// Match values are globs where "*" matches any run of characters. Rules are
+// ordered by priority (highest first), then by the number of match
+// attributes, then by position in the file. Rules without a limit or key
+// inherit them from defaults, and when no rule matches the defaults apply.
+// JSON files use the same structure.
+package rules
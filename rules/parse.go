@@ -0,0 +1,236 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+// Parse parses a YAML or JSON rules document. name is used in error messages
+// and is usually the file path.
+func Parse(name string, data []byte) (*RuleSet, error) {
+	p := parser{file: name}
+	return p.parse(data)
+}
+
+type parser struct {
+	file string
+}
+
+func (p *parser) errorf(n *yaml.Node, format string, args ...interface{}) error {
+	return &Error{File: p.file, Line: n.Line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parse(data []byte) (*RuleSet, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line, msg := splitYAMLError(err)
+		return nil, &Error{File: p.file, Line: line, Msg: msg}
+	}
+	rs := &RuleSet{}
+	if len(doc.Content) == 0 {
+		return rs, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, p.errorf(root, "expected a mapping with defaults and rules")
+	}
+
+	var rulesNode *yaml.Node
+	err := p.fields(root, func(key string, v *yaml.Node) error {
+		switch key {
+		case "defaults":
+			d, err := p.rule(v, false)
+			if err != nil {
+				return err
+			}
+			d.Name = DefaultRuleName
+			rs.defaults = d
+		case "rules":
+			rulesNode = v
+		default:
+			return p.errorf(v, "unknown field %q", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rulesNode != nil {
+		if rulesNode.Kind != yaml.SequenceNode {
+			return nil, p.errorf(rulesNode, "rules must be a list")
+		}
+		seen := make(map[string]int)
+		for i, n := range rulesNode.Content {
+			r, err := p.rule(n, true)
+			if err != nil {
+				return nil, err
+			}
+			if r.Name == "" {
+				r.Name = "rule-" + strconv.Itoa(i+1)
+			}
+			if r.Name == DefaultRuleName {
+				return nil, p.errorf(n, "rule name %q is reserved", DefaultRuleName)
+			}
+			if line, ok := seen[r.Name]; ok {
+				return nil, p.errorf(n, "duplicate rule name %q (first defined on line %d)", r.Name, line)
+			}
+			seen[r.Name] = n.Line
+			if err := p.inherit(n, r, rs.defaults); err != nil {
+				return nil, err
+			}
+			rs.rules = append(rs.rules, *r)
+		}
+	}
+	if d := rs.defaults; d != nil && !d.Limit.IsZero() && d.Key == "" {
+		return nil, &Error{File: p.file, Line: d.Line, Msg: "defaults with a limit must also define a key"}
+	}
+	sortRules(rs.rules)
+	return rs, nil
+}
+
+// inherit fills missing limit and key from defaults.
+func (p *parser) inherit(n *yaml.Node, r *Rule, defaults *Rule) error {
+	if defaults != nil {
+		if r.Limit.IsZero() {
+			r.Limit = defaults.Limit
+		}
+		if r.Key == "" {
+			r.Key = defaults.Key
+		}
+	}
+	if r.Limit.IsZero() {
+		return p.errorf(n, "rule %q has no limit and defaults define none", r.Name)
+	}
+	if r.Key == "" {
+		return p.errorf(n, "rule %q has no key and defaults define none", r.Name)
+	}
+	return nil
+}
+
+// rule decodes a rule or the defaults block.
+func (p *parser) rule(n *yaml.Node, allowMatch bool) (*Rule, error) {
+	if n.Kind != yaml.MappingNode {
+		return nil, p.errorf(n, "expected a mapping")
+	}
+	r := &Rule{Line: n.Line}
+	err := p.fields(n, func(key string, v *yaml.Node) error {
+		switch key {
+		case "name":
+			if !allowMatch {
+				return p.errorf(v, "defaults cannot have a name")
+			}
+			s, err := p.scalar(v)
+			if err != nil {
+				return err
+			}
+			r.Name = s
+		case "match":
+			if !allowMatch {
+				return p.errorf(v, "defaults cannot have match conditions")
+			}
+			m, err := p.match(v)
+			if err != nil {
+				return err
+			}
+			r.Match = m
+		case "limit":
+			s, err := p.scalar(v)
+			if err != nil {
+				return err
+			}
+			l, err := gcra.ParseLimit(s)
+			if err != nil {
+				return p.errorf(v, "%v", err)
+			}
+			r.Limit = l
+		case "key":
+			s, err := p.scalar(v)
+			if err != nil {
+				return err
+			}
+			if err := checkTemplate(s); err != nil {
+				return p.errorf(v, "%v", err)
+			}
+			r.Key = s
+		case "priority":
+			s, err := p.scalar(v)
+			if err != nil {
+				return err
+			}
+			prio, err := strconv.Atoi(s)
+			if err != nil {
+				return p.errorf(v, "invalid priority %q", s)
+			}
+			r.Priority = prio
+		default:
+			return p.errorf(v, "unknown field %q", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (p *parser) match(n *yaml.Node) (map[string]string, error) {
+	if n.Kind != yaml.MappingNode {
+		return nil, p.errorf(n, "match must be a mapping of attribute to pattern")
+	}
+	m := make(map[string]string, len(n.Content)/2)
+	err := p.fields(n, func(key string, v *yaml.Node) error {
+		s, err := p.scalar(v)
+		if err != nil {
+			return err
+		}
+		m[key] = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fields iterates over a mapping node, rejecting duplicate keys.
+func (p *parser) fields(n *yaml.Node, fn func(key string, v *yaml.Node) error) error {
+	seen := make(map[string]bool, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			return p.errorf(k, "expected a string key")
+		}
+		if seen[k.Value] {
+			return p.errorf(k, "duplicate field %q", k.Value)
+		}
+		seen[k.Value] = true
+		if err := fn(k.Value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) scalar(n *yaml.Node) (string, error) {
+	if n.Kind != yaml.ScalarNode {
+		return "", p.errorf(n, "expected a scalar value")
+	}
+	return n.Value, nil
+}
+
+// splitYAMLError extracts the line number and message from a yaml syntax
+// error of the form "yaml: line N: msg".
+func splitYAMLError(err error) (int, string) {
+	var line int
+	if _, scanErr := fmt.Sscanf(err.Error(), "yaml: line %d:", &line); scanErr != nil {
+		return 0, err.Error()
+	}
+	_, msg, _ := strings.Cut(err.Error(), fmt.Sprintf("line %d: ", line))
+	return line, msg
+}
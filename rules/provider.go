@@ -0,0 +1,179 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+// DefaultPollInterval is how often a FileProvider checks its file for changes.
+const DefaultPollInterval = 5 * time.Second
+
+// ReloadEvent describes an attempt to reload a rules file.
+type ReloadEvent struct {
+	Path  string    // file that was read
+	Time  time.Time // when the reload was attempted
+	Rules int       // number of rules now being served
+	Err   error     // non-nil if the file was rejected and the previous rules were kept
+}
+
+// WatchOption configures a FileProvider.
+type WatchOption func(*FileProvider)
+
+// WithPollInterval sets how often the file is checked for changes. Intervals
+// of zero or less leave the default.
+func WithPollInterval(d time.Duration) WatchOption {
+	return func(p *FileProvider) {
+		if d > 0 {
+			p.interval = d
+		}
+	}
+}
+
+// OnReload registers fn to be called after every reload attempt, successful
+// or not. fn runs on the watcher goroutine and should not block.
+func OnReload(fn func(ReloadEvent)) WatchOption {
+	return func(p *FileProvider) {
+		p.onReload = fn
+	}
+}
+
+// FileProvider serves rules from a file and reloads them when the file
+// changes. A file that fails to parse or validate is rejected as a whole and
+// the last good rules keep being served. It implements gcra.LimitProvider,
+// resolving limits by rule name.
+type FileProvider struct {
+	path     string
+	interval time.Duration
+	onReload func(ReloadEvent)
+
+	current atomic.Pointer[RuleSet]
+
+	mu      sync.Mutex // guards the fields below
+	modTime time.Time
+	size    int64
+	digest  [sha256.Size]byte
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+var _ gcra.LimitProvider = (*FileProvider)(nil)
+
+// Watch loads the rules file at path and starts polling it for changes. The
+// initial load must succeed. Call Close to stop watching.
+func Watch(path string, opts ...WatchOption) (*FileProvider, error) {
+	p := &FileProvider{
+		path:     path,
+		interval: DefaultPollInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := p.reload(true); err != nil {
+		return nil, err
+	}
+	go p.watch()
+	return p, nil
+}
+
+// Limit implements gcra.LimitProvider using the rule with the given name.
+func (p *FileProvider) Limit(name string) (gcra.Limit, bool) {
+	r, ok := p.current.Load().Lookup(name)
+	return r.Limit, ok
+}
+
+// RuleSet returns the rules currently being served.
+func (p *FileProvider) RuleSet() *RuleSet {
+	return p.current.Load()
+}
+
+// Match is a shortcut for RuleSet().Match(attrs).
+func (p *FileProvider) Match(attrs map[string]string) (*Match, error) {
+	return p.current.Load().Match(attrs)
+}
+
+// Reload re-reads the file immediately, regardless of whether it changed.
+// On error the previous rules are kept.
+func (p *FileProvider) Reload() error {
+	return p.reload(true)
+}
+
+// Close stops watching the file. The last loaded rules remain available.
+func (p *FileProvider) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+	return nil
+}
+
+func (p *FileProvider) watch() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.reload(false)
+		}
+	}
+}
+
+// reload reads and parses the file if it changed since the last attempt (or
+// unconditionally when force is set) and swaps in the new rules on success.
+// A file that is briefly missing while polling, as happens when editors
+// replace it, is ignored until it reappears.
+func (p *FileProvider) reload(force bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		if force {
+			return p.emit(err)
+		}
+		return nil
+	}
+	if !force && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return nil
+	}
+	p.modTime, p.size = info.ModTime(), info.Size()
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return p.emit(err)
+	}
+	digest := sha256.Sum256(data)
+	if !force && digest == p.digest {
+		return nil
+	}
+	p.digest = digest
+
+	rs, err := Parse(p.path, data)
+	if err != nil {
+		return p.emit(err)
+	}
+	p.current.Store(rs)
+	return p.emit(nil)
+}
+
+func (p *FileProvider) emit(err error) error {
+	if p.onReload != nil {
+		ev := ReloadEvent{Path: p.path, Time: time.Now(), Err: err}
+		if rs := p.current.Load(); rs != nil {
+			ev.Rules = len(rs.rules)
+		}
+		p.onReload(ev)
+	}
+	return err
+}
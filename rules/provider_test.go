@@ -0,0 +1,85 @@
+package rules_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	"github.com/sagarsuperuser/leaky-bucket-gcra/rules"
+)
+
+func TestFileProviderReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.yaml")
+	write := func(doc string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(path, []byte(doc), 0o644))
+	}
+	write("rules:\n  - {name: api, key: \"k\", limit: 10/s}\n")
+
+	var (
+		mu     sync.Mutex
+		events []rules.ReloadEvent
+	)
+	p, err := rules.Watch(path,
+		rules.WithPollInterval(5*time.Millisecond),
+		rules.OnReload(func(ev rules.ReloadEvent) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+
+	limit, ok := p.Limit("api")
+	require.True(t, ok)
+	assert.Equal(t, gcra.PerSecond(10, 10), limit)
+
+	// Invalid files are rejected and the last good rules keep being served.
+	write("rules:\n  - {name: api, key: \"k\", limit: ten/s}\n")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Error(t, events[1].Err)
+	assert.Equal(t, 1, events[1].Rules)
+	mu.Unlock()
+	limit, _ = p.Limit("api")
+	assert.Equal(t, gcra.PerSecond(10, 10), limit)
+
+	write("rules:\n  - {name: api, key: \"k\", limit: 20/s burst 40}\n  - {name: web, key: \"k\", limit: 1/s}\n")
+	require.Eventually(t, func() bool {
+		limit, _ := p.Limit("api")
+		return limit == gcra.PerSecond(20, 40)
+	}, time.Second, 5*time.Millisecond)
+	_, ok = p.Limit("web")
+	assert.True(t, ok)
+}
+
+func TestWatchRequiresValidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.yaml")
+	_, err := rules.Watch(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("rules: {}\n"), 0o644))
+	_, err = rules.Watch(path)
+	require.Error(t, err)
+}
+
+func TestWatchIgnoresNonPositivePollInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - {name: api, key: \"k\", limit: 10/s}\n"), 0o644))
+	for _, d := range []time.Duration{0, -time.Second} {
+		p, err := rules.Watch(path, rules.WithPollInterval(d))
+		require.NoError(t, err)
+		require.NoError(t, p.Close())
+	}
+}
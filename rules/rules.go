@@ -0,0 +1,222 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+)
+
+// DefaultRuleName is reported as the rule name when only the defaults apply.
+const DefaultRuleName = "default"
+
+// Rule is a single entry of a rules file.
+type Rule struct {
+	Name     string            // unique rule name; generated from the position when omitted
+	Match    map[string]string // attribute name -> glob; all entries must match
+	Limit    gcra.Limit        // limit applied when the rule matches
+	Key      string            // key template, e.g. "tenant:{tenant}"
+	Priority int               // higher priorities are evaluated first
+	Line     int               // line in the source file where the rule starts
+}
+
+// Match is a rule that applies to a set of request attributes.
+type Match struct {
+	Rule  string     // name of the matching rule, or DefaultRuleName
+	Limit gcra.Limit // limit to enforce
+	Key   string     // rendered key template
+}
+
+// RuleSet is an immutable, validated collection of rules ordered by precedence.
+type RuleSet struct {
+	rules    []Rule
+	defaults *Rule
+}
+
+// Error reports an invalid rules file, pointing at the offending line.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Load reads and parses the rules file at path.
+func Load(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Rules returns the rules in precedence order.
+func (rs *RuleSet) Rules() []Rule {
+	out := make([]Rule, len(rs.rules))
+	copy(out, rs.rules)
+	return out
+}
+
+// Lookup returns the rule with the given name. DefaultRuleName resolves to
+// the defaults when they define a limit.
+func (rs *RuleSet) Lookup(name string) (Rule, bool) {
+	for _, r := range rs.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	if name == DefaultRuleName && rs.defaults != nil && !rs.defaults.Limit.IsZero() {
+		return *rs.defaults, true
+	}
+	return Rule{}, false
+}
+
+// Match returns the highest precedence rule applying to attrs. It returns
+// nil when neither a rule nor the defaults apply.
+func (rs *RuleSet) Match(attrs map[string]string) (*Match, error) {
+	for _, r := range rs.rules {
+		if r.matches(attrs) {
+			return r.render(attrs)
+		}
+	}
+	return rs.matchDefaults(attrs)
+}
+
+// MatchAll returns every rule applying to attrs in precedence order, so
+// callers can enforce several limits at once. The defaults are returned only
+// when no rule matches.
+func (rs *RuleSet) MatchAll(attrs map[string]string) ([]Match, error) {
+	var out []Match
+	for _, r := range rs.rules {
+		if !r.matches(attrs) {
+			continue
+		}
+		m, err := r.render(attrs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	m, err := rs.matchDefaults(attrs)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return []Match{*m}, nil
+}
+
+func (rs *RuleSet) matchDefaults(attrs map[string]string) (*Match, error) {
+	if rs.defaults == nil || rs.defaults.Limit.IsZero() {
+		return nil, nil
+	}
+	return rs.defaults.render(attrs)
+}
+
+func (r Rule) matches(attrs map[string]string) bool {
+	for name, pattern := range r.Match {
+		v, ok := attrs[name]
+		if !ok || !globMatch(pattern, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Rule) render(attrs map[string]string) (*Match, error) {
+	key, err := expand(r.Key, attrs)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	return &Match{Rule: r.Name, Limit: r.Limit, Key: key}, nil
+}
+
+// sortRules orders rules by priority, then specificity, keeping file order
+// for ties.
+func sortRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return len(rules[i].Match) > len(rules[j].Match)
+	})
+}
+
+// globMatch reports whether s matches pattern, where '*' matches any run of
+// characters (including '/').
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+// expand replaces {attr} placeholders in tmpl with values from attrs.
+func expand(tmpl string, attrs map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			b.WriteString(tmpl)
+			return b.String(), nil
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		name := tmpl[i+1 : i+j]
+		v, ok := attrs[name]
+		if !ok {
+			return "", fmt.Errorf("key template references missing attribute %q", name)
+		}
+		b.WriteString(tmpl[:i])
+		b.WriteString(v)
+		tmpl = tmpl[i+j+1:]
+	}
+}
+
+// checkTemplate validates placeholder syntax in a key template.
+func checkTemplate(tmpl string) error {
+	open := false
+	start := 0
+	for i, c := range tmpl {
+		switch c {
+		case '{':
+			if open {
+				return fmt.Errorf("nested '{' in key template %q", tmpl)
+			}
+			open, start = true, i
+		case '}':
+			if !open {
+				return fmt.Errorf("unbalanced '}' in key template %q", tmpl)
+			}
+			if i == start+1 {
+				return fmt.Errorf("empty placeholder in key template %q", tmpl)
+			}
+			open = false
+		}
+	}
+	if open {
+		return fmt.Errorf("unterminated placeholder in key template %q", tmpl)
+	}
+	return nil
+}
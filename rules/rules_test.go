@@ -0,0 +1,110 @@
+package rules_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	"github.com/sagarsuperuser/leaky-bucket-gcra/rules"
+)
+
+const testRules = `
+defaults:
+  key: "ip:{ip}"
+  limit: "10/s burst 20"
+rules:
+  - name: free-api
+    match: {route: "/api/*", tier: "free"}
+    limit: "100/m burst 20"
+    key: "tenant:{tenant}"
+  - name: api
+    match: {route: "/api/*"}
+    limit: "1000/m"
+  - name: admin
+    match: {route: "/api/admin/*"}
+    limit: "5/s burst 1"
+    priority: 10
+`
+
+func TestMatchPrecedence(t *testing.T) {
+	rs, err := rules.Parse("rules.yaml", []byte(testRules))
+	require.NoError(t, err)
+
+	m, err := rs.Match(map[string]string{"route": "/api/v1/users", "tier": "free", "tenant": "acme", "ip": "10.0.0.1"})
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, "free-api", m.Rule)
+	assert.Equal(t, gcra.PerMinute(100, 20), m.Limit)
+	assert.Equal(t, "tenant:acme", m.Key)
+
+	m, err = rs.Match(map[string]string{"route": "/api/admin/keys", "tier": "free", "tenant": "acme", "ip": "10.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", m.Rule)
+	assert.Equal(t, "ip:10.0.0.1", m.Key)
+
+	all, err := rs.MatchAll(map[string]string{"route": "/api/v1", "tier": "free", "tenant": "acme", "ip": "10.0.0.1"})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "free-api", all[0].Rule)
+	assert.Equal(t, "api", all[1].Rule)
+	assert.Equal(t, gcra.PerMinute(1000, 1000), all[1].Limit)
+}
+
+func TestMatchDefaults(t *testing.T) {
+	rs, err := rules.Parse("rules.yaml", []byte(testRules))
+	require.NoError(t, err)
+
+	m, err := rs.Match(map[string]string{"route": "/health", "ip": "10.0.0.2"})
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.Equal(t, rules.DefaultRuleName, m.Rule)
+	assert.Equal(t, gcra.Limit{Rate: 10, Burst: 20, Period: time.Second}, m.Limit)
+	assert.Equal(t, "ip:10.0.0.2", m.Key)
+
+	_, err = rs.Match(map[string]string{"route": "/health"})
+	require.Error(t, err)
+}
+
+func TestParseJSON(t *testing.T) {
+	rs, err := rules.Parse("rules.json", []byte(`{
+  "rules": [
+    {"name": "uploads", "match": {"route": "/upload"}, "limit": "1/500ms burst 2", "key": "u:{user}"}
+  ]
+}`))
+	require.NoError(t, err)
+	m, err := rs.Match(map[string]string{"route": "/upload", "user": "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, gcra.Limit{Rate: 1, Burst: 2, Period: 500 * time.Millisecond}, m.Limit)
+
+	m, err = rs.Match(map[string]string{"route": "/download"})
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestValidationErrorsHaveLines(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		line int
+	}{
+		{"bad limit", "rules:\n  - name: a\n    key: k\n    limit: \"ten/s\"\n", 4},
+		{"unknown field", "rules:\n  - name: a\n    key: k\n    limit: 1/s\n    limt: 2/s\n", 5},
+		{"missing limit", "rules:\n  - name: a\n    key: k\n", 2},
+		{"duplicate name", "rules:\n  - {name: a, key: k, limit: 1/s}\n  - {name: a, key: k, limit: 1/s}\n", 3},
+		{"bad template", "defaults:\n  key: \"{tenant\"\n", 2},
+		{"syntax", "rules:\n  - name: a\n    key: b: c\n", 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := rules.Parse("rules.yaml", []byte(tc.doc))
+			var rerr *rules.Error
+			require.True(t, errors.As(err, &rerr), "got %v", err)
+			assert.Equal(t, tc.line, rerr.Line, rerr.Error())
+			assert.Equal(t, "rules.yaml", rerr.File)
+		})
+	}
+}
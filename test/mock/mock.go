@@ -33,11 +33,13 @@ func (tt *testTime) Now() time.Time {
 	return tt.cur
 }
 
-// Unix returns seconds elapsed since the fake clock start.
+// Unix returns seconds elapsed since the fake clock start, to the
+// microsecond like the Redis clock.
 func (tt *testTime) Unix() float64 {
 	tt.mu.Lock()
 	defer tt.mu.Unlock()
-	return tt.cur.Sub(tt.start).Seconds()
+	d := tt.cur.Sub(tt.start)
+	return float64(d/time.Second) + float64(d%time.Second/time.Microsecond)/1000000
 }
 
 // Advance advances the fake time.
@@ -100,27 +102,86 @@ func NewTestTime(start time.Time) *testTime {
 // NewMockClient implements the Client interface entirely in-memory for examples.
 func NewMockClient(clock *testTime) *mockClient {
 	return &mockClient{
-		store: make(map[string]float64),
-		clock: clock,
+		store:  make(map[string]float64),
+		expiry: make(map[string]float64),
+		fixed:  make(map[string]fixedWindow),
+		logs:   make(map[string][]float64),
+		slides: make(map[string]slidingCounter),
+		slots:  make(map[string]map[string]float64),
+		hashes: make(map[string]map[string]string),
+		subs:   make(map[string][]func(string)),
+		clock:  clock,
 	}
 }
 
 // mockClient simulates the Lua script logic for tests without Redis backend.
 type mockClient struct {
-	store map[string]float64
-	clock *testTime
+	mu     sync.Mutex
+	store  map[string]float64
+	expiry map[string]float64 // when keys of store expire, as from clock.Unix
+	fixed  map[string]fixedWindow
+	logs   map[string][]float64
+	slides map[string]slidingCounter
+	slots  map[string]map[string]float64 // slot id to lease expiry
+	hashes map[string]map[string]string
+	subs   map[string][]func(string)
+	clock  *testTime
 }
 
 func (m *mockClient) DoCmd(rcv interface{}, cmd, key string, args ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	switch strings.ToUpper(cmd) {
 	case "DEL":
-		delete(m.store, key)
+		for _, k := range append([]interface{}{key}, args...) {
+			k := fmt.Sprint(k)
+			delete(m.store, k)
+			delete(m.expiry, k)
+			delete(m.fixed, k)
+			delete(m.logs, k)
+			delete(m.slides, k)
+			delete(m.slots, k)
+			delete(m.hashes, k)
+		}
+	case "HSET":
+		h, ok := m.hashes[key]
+		if !ok {
+			h = make(map[string]string)
+			m.hashes[key] = h
+		}
+		for i := 0; i+1 < len(args); i += 2 {
+			h[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+		}
+	case "HDEL":
+		for _, f := range args {
+			delete(m.hashes[key], fmt.Sprint(f))
+		}
+	case "HGET":
+		if rcv != nil {
+			if v, ok := m.hashes[key][fmt.Sprint(args[0])]; ok {
+				assign(rcv, v)
+			} else {
+				assign(rcv, nil)
+			}
+		}
+	case "HGETALL":
+		if rcv != nil {
+			out := make(map[string]string, len(m.hashes[key]))
+			for f, v := range m.hashes[key] {
+				out[f] = v
+			}
+			assign(rcv, out)
+		}
+	case "PUBLISH":
+		for _, fn := range m.subs[key] {
+			fn(fmt.Sprint(args[0]))
+		}
 	case "PING":
 		// no-op
 	case "GET":
 		if rcv != nil {
-			if v, ok := m.store[key]; ok {
-				assign(rcv, fmt.Sprintf("%g", v))
+			if s := m.state(key); s.Exists {
+				assign(rcv, fmt.Sprintf("%g", s.TAT))
 			} else {
 				assign(rcv, "")
 			}
@@ -130,7 +191,46 @@ func (m *mockClient) DoCmd(rcv interface{}, cmd, key string, args ...interface{}
 }
 
 func (m *mockClient) EvalScript(rcv interface{}, script string, keys []string, args ...interface{}) error {
-	result, err := m.eval(keys[0], args...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []interface{}
+	var err error
+	switch name := scriptName(script); name {
+	case "allow_n":
+		result, err = m.eval(keys[0], args...)
+	case "lease":
+		result, err = m.lease(keys[0], args...)
+	case "allow_batch":
+		result, err = m.batch(keys[0], args...)
+	case "fixed_window":
+		result, err = m.fixedWindow(keys[0], args...)
+	case "sliding_window_log":
+		result, err = m.slidingWindowLog(keys[0], args...)
+	case "sliding_window_counter":
+		result, err = m.slidingWindowCounter(keys[0], args...)
+	case "fair_share":
+		result, err = m.fairShare(keys, args...)
+	case "allow_hierarchy":
+		result, err = m.hierarchy(keys, args...)
+	case "quota":
+		result, err = m.quota(keys[0], args...)
+	case "adapt":
+		result, err = m.adapt(keys[0], args...)
+	case "acquire_slot":
+		result, err = m.acquireSlot(keys[0], args...)
+	case "renew_slot":
+		result, err = m.renewSlot(keys[0], args...)
+	case "release_slot":
+		result = []interface{}{int64(0)}
+		if _, ok := m.slots[keys[0]][fmt.Sprint(args[0])]; ok {
+			delete(m.slots[keys[0]], fmt.Sprint(args[0]))
+			result = []interface{}{int64(1)}
+		}
+	case "return_tokens":
+		result, err = m.returnTokens(keys[0], args...)
+	default:
+		err = fmt.Errorf("unknown script %q", name)
+	}
 	if err != nil {
 		return err
 	}
@@ -142,6 +242,22 @@ func (m *mockClient) EvalScript(rcv interface{}, script string, keys []string, a
 	return nil
 }
 
+// scriptName returns the name declared by a "-- name: " line in script.
+func scriptName(script string) string {
+	for _, line := range strings.Split(script, "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "-- name: "); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Subscribe registers fn for messages published on channel through DoCmd.
+func (m *mockClient) Subscribe(channel string, fn func(message string)) (func() error, error) {
+	m.subs[channel] = append(m.subs[channel], fn)
+	return func() error { return nil }, nil
+}
+
 func (m *mockClient) PipeAppend(pipeline gcra.Pipeline, rcv interface{}, cmd, key string, args ...interface{}) gcra.Pipeline {
 	return append(pipeline, radix.FlatCmd(rcv, cmd, key, args...))
 }
@@ -154,76 +270,518 @@ func (m *mockClient) ImplicitPipeliningEnabled() bool {
 }
 
 func (m *mockClient) eval(key string, args ...interface{}) ([]interface{}, error) {
-	if len(args) < 4 {
+	f, err := parseArgs(min(len(args), 6), args)
+	if err != nil {
+		return nil, err
+	}
+	if len(f) < 4 {
 		return nil, fmt.Errorf("not enough args")
 	}
+	limit := limitArgs(f)
+	var reserve float64
+	if len(f) > 4 {
+		reserve = f[4]
+	}
+	if len(f) > 5 {
+		limit.Overdraft = int64(f[5])
+	}
+	state := m.state(key)
+	startEmpty := len(args) > 6 && fmt.Sprint(args[6]) == "true"
+	keepFull := 0.0
+	if startEmpty {
+		keepFull = startEmptyKeepFull
+	}
+	if !state.Exists && startEmpty && limit.Burst > 0 {
+		state = gcra.State{TAT: m.clock.Unix() + f[2]/f[1]*f[0], Exists: true}
+		m.setStateTTL(key, state, keepFull)
+	}
+	// The Limiter sends the reserve of a normal request, a fraction of Burst.
+	var reserves gcra.PriorityReserves
+	if reserve > 0 && limit.Burst > 0 {
+		reserves.Normal = reserve / float64(limit.Burst)
+	}
+	res, next, err := gcra.DecidePriority(state, limit, int64(f[3]), gcra.PriorityNormal, reserves, m.scriptTime())
+	if err != nil {
+		return nil, err
+	}
+	if next != state {
+		m.setStateTTL(key, next, keepFull)
+	}
+	return reply(res), nil
+}
 
-	parse := func(v interface{}) (float64, error) {
-		return strconv.ParseFloat(fmt.Sprint(v), 64)
+// lease grants as many tokens between the minimum and maximum as the bucket
+// holds, mirroring the lease script.
+func (m *mockClient) lease(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(5, args)
+	if err != nil {
+		return nil, err
+	}
+	burst, rate, period, minCost, maxCost := f[0], f[1], f[2], f[3], f[4]
+	state := m.state(key)
+	cost := minCost
+	if minCost <= burst {
+		now := m.clock.Unix()
+		tat := now
+		if state.Exists {
+			tat = state.TAT
+		}
+		emissionInterval := period / rate
+		base := math.Max(tat, now)
+		cost = math.Max(minCost, math.Min(math.Min(maxCost, burst), math.Floor((now+float64(emissionInterval*burst)-base)/emissionInterval)))
 	}
+	res, next, err := gcra.Decide(state, limitArgs(f), int64(cost), m.scriptTime())
+	if err != nil {
+		return nil, err
+	}
+	m.setState(key, next)
+	return reply(res), nil
+}
 
-	burst, err := parse(args[0])
+func (m *mockClient) batch(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(len(args), args)
 	if err != nil {
 		return nil, err
 	}
-	rate, err := parse(args[1])
+	if len(f) < 3 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	limit := limitArgs(f)
+	now := m.scriptTime()
+	state := m.state(key)
+	var out []interface{}
+	for _, cost := range f[3:] {
+		var res *gcra.RateLimitResult
+		res, state, err = gcra.Decide(state, limit, int64(cost), now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, reply(res)...)
+	}
+	m.setState(key, state)
+	return out, nil
+}
+
+func (m *mockClient) returnTokens(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(3, args)
 	if err != nil {
 		return nil, err
 	}
-	period, err := parse(args[2])
+	rate, period, tokens := f[0], f[1], f[2]
+	state := m.state(key)
+	if !state.Exists {
+		return []interface{}{int64(0)}, nil
+	}
+	// The key keeps its expiry.
+	m.store[key] = math.Max(state.TAT-period/rate*tokens, m.clock.Unix())
+	return []interface{}{int64(tokens)}, nil
+}
+
+type fixedWindow struct {
+	end, count float64
+}
+
+type slidingCounter struct {
+	window, cur, prev float64
+}
+
+// unixNow returns the fake time in Unix seconds, for calendar-aligned windows.
+func (m *mockClient) unixNow() float64 {
+	return float64(m.clock.Now().UnixMicro()) / 1e6
+}
+
+func windowResult(allowed, remaining, retryAfter, resetAfter float64, reason gcra.Reason) []interface{} {
+	retry := "-1"
+	if retryAfter >= 0 {
+		retry = fmt.Sprintf("%g", retryAfter)
+	}
+	return []interface{}{int64(allowed), int64(remaining), retry, fmt.Sprintf("%g", resetAfter), int64(reason)}
+}
+
+func (m *mockClient) fixedWindow(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(4, args)
 	if err != nil {
 		return nil, err
 	}
-	cost, err := parse(args[3])
+	rate, period, cost := f[1], f[2], f[3]
+	now := m.unixNow()
+	end := (math.Floor(now/period) + 1) * period
+
+	w := m.fixed[key]
+	if w.end != end {
+		w = fixedWindow{end: end}
+	}
+	resetAfter := 0.0
+	if w.count > 0 {
+		resetAfter = end - now
+	}
+	switch {
+	case cost > rate:
+		return windowResult(0, 0, -1, resetAfter, gcra.ReasonCostExceedsBurst), nil
+	case w.count+cost > rate:
+		return windowResult(0, 0, end-now, resetAfter, gcra.ReasonRateExceeded), nil
+	}
+	w.count += cost
+	m.fixed[key] = w
+	return windowResult(cost, rate-w.count, -1, end-now, gcra.ReasonAllowed), nil
+}
+
+func (m *mockClient) slidingWindowLog(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(4, args)
 	if err != nil {
 		return nil, err
 	}
+	rate, period, cost := f[1], f[2], f[3]
+	now := m.unixNow()
 
-	emissionInterval := period / rate
-	increment := emissionInterval * cost
-	burstOffset := emissionInterval * burst
-	now := m.clock.Unix()
+	log := m.logs[key]
+	for len(log) > 0 && log[0] <= now-period {
+		log = log[1:]
+	}
+	m.logs[key] = log
+	count := float64(len(log))
+	resetAfter := 0.0
+	if len(log) > 0 {
+		resetAfter = log[len(log)-1] + period - now
+	}
+	switch {
+	case cost > rate:
+		return windowResult(0, 0, -1, resetAfter, gcra.ReasonCostExceedsBurst), nil
+	case count+cost > rate:
+		oldest := log[int(count+cost-rate)-1]
+		return windowResult(0, 0, oldest+period-now, resetAfter, gcra.ReasonRateExceeded), nil
+	}
+	for i := 0; i < int(cost); i++ {
+		log = append(log, now)
+	}
+	m.logs[key] = log
+	return windowResult(cost, rate-count-cost, -1, period, gcra.ReasonAllowed), nil
+}
 
-	tat := now
-	if prev, ok := m.store[key]; ok {
-		tat = prev
+func (m *mockClient) slidingWindowCounter(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(4, args)
+	if err != nil {
+		return nil, err
 	}
+	rate, period, cost := f[1], f[2], f[3]
+	now := m.unixNow()
+	window := math.Floor(now / period)
+	elapsed := now/period - window
 
-	if cost > burst {
-		return []interface{}{int64(0), int64(0), "-1", fmt.Sprintf("%f", tat-now)}, nil
+	s, ok := m.slides[key]
+	switch {
+	case ok && s.window == window-1:
+		s.prev, s.cur = s.cur, 0
+	case !ok || s.window != window:
+		s.prev, s.cur = 0, 0
 	}
+	count := s.cur + s.prev*(1-elapsed)
+	resetAfter := 0.0
+	if s.cur > 0 {
+		resetAfter = (2 - elapsed) * period
+	} else if s.prev > 0 {
+		resetAfter = (1 - elapsed) * period
+	}
+	switch {
+	case cost > rate:
+		return windowResult(0, 0, -1, resetAfter, gcra.ReasonCostExceedsBurst), nil
+	case count+cost > rate:
+		var retryAfter float64
+		if s.cur+cost <= rate {
+			retryAfter = (1 - (rate-s.cur-cost)/s.prev - elapsed) * period
+		} else {
+			retryAfter = (1 - elapsed + math.Max(0, 1-(rate-cost)/s.cur)) * period
+		}
+		return windowResult(0, 0, retryAfter, resetAfter, gcra.ReasonRateExceeded), nil
+	}
+	s.window = window
+	s.cur += cost
+	m.slides[key] = s
+	return windowResult(cost, math.Floor(rate-count-cost), -1, (2-elapsed)*period, gcra.ReasonAllowed), nil
+}
 
-	newTAT := math.Max(tat, now) + increment
-	allowAt := newTAT - burstOffset
-	diff := now - allowAt
+// hierarchy charges every key or none, mirroring the allow_hierarchy script.
+func (m *mockClient) hierarchy(keys []string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(1+3*len(keys), args)
+	if err != nil {
+		return nil, err
+	}
+	cost := f[0]
+	now := m.scriptTime()
 
-	var allowed int64
-	var retryAfter float64
-	var resetAfter float64
-	var remaining float64
+	levels := make([]level, len(keys))
+	for i, key := range keys {
+		res, next, err := gcra.Decide(m.state(key), limitArgs(f[1+3*i:]), int64(cost), now)
+		if err != nil {
+			return nil, err
+		}
+		levels[i] = level{key, reply(res), next}
+	}
+	return m.chargeAll(levels, cost), nil
+}
 
-	if diff < 0 {
-		allowed = 0
-		remaining = 0
-		resetAfter = tat - now
-		retryAfter = diff * -1
-		if retryAfter > burst {
-			retryAfter = -1
+// fairShare mirrors the fair_share script: it records the tenant's activity
+// and weight, then charges the global bucket and the tenant's share as a
+// two-level hierarchy.
+func (m *mockClient) fairShare(keys []string, args ...interface{}) ([]interface{}, error) {
+	if len(args) < 7 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	f, err := parseArgs(4, args)
+	if err != nil {
+		return nil, err
+	}
+	w, err := parseArgs(2, args[5:])
+	if err != nil {
+		return nil, err
+	}
+	cost := f[0]
+	tenant, weight, window := fmt.Sprint(args[4]), w[0], w[1]
+	now := m.clock.Unix()
+
+	active := m.slots[keys[2]]
+	if active == nil {
+		active = make(map[string]float64)
+		m.slots[keys[2]] = active
+	}
+	weights := m.hashes[keys[3]]
+	if weights == nil {
+		weights = make(map[string]string)
+		m.hashes[keys[3]] = weights
+	}
+	for member, seen := range active {
+		if seen <= now-window {
+			delete(active, member)
+			delete(weights, member)
+		}
+	}
+	active[tenant] = now
+	weights[tenant] = fmt.Sprint(weight)
+	total := 0.0
+	for _, v := range weights {
+		x, _ := strconv.ParseFloat(v, 64)
+		total += x
+	}
+	share := math.Min(weight/total, 1)
+
+	limit := limitArgs(f[1:])
+	global, next, err := gcra.Decide(m.state(keys[0]), limit, int64(cost), m.scriptTime())
+	if err != nil {
+		return nil, err
+	}
+	tenantRes, tenantNext, err := gcra.DecideShare(m.state(keys[1]), limit, int64(cost), share, m.scriptTime())
+	if err != nil {
+		return nil, err
+	}
+	out := m.chargeAll([]level{{keys[0], reply(global), next}, {keys[1], reply(tenantRes), tenantNext}}, cost)
+	return append(out, fmt.Sprint(share), int64(len(active))), nil
+}
+
+// level is the decision of one bucket in an all-or-nothing charge.
+type level struct {
+	key   string
+	reply []interface{}
+	next  gcra.State
+}
+
+// chargeAll stores the new state of every level if all of them allowed the
+// request. Otherwise nothing is charged, and levels that had room report
+// Allowed 0 and their state before the request, as the scripts do.
+func (m *mockClient) chargeAll(levels []level, cost float64) []interface{} {
+	denied := false
+	for _, l := range levels {
+		if l.reply[4] != int64(gcra.ReasonAllowed) {
+			denied = true
+		}
+	}
+	now := m.clock.Unix()
+	var out []interface{}
+	for _, l := range levels {
+		r := l.reply
+		if !denied {
+			m.setState(l.key, l.next)
+		} else if r[4] == int64(gcra.ReasonAllowed) {
+			tat := now
+			if s := m.state(l.key); s.Exists {
+				tat = s.TAT
+			}
+			r = []interface{}{int64(0), r[1].(int64) + int64(cost), r[2], luaNumber(math.Max(tat-now, 0)), r[4]}
 		}
+		out = append(out, r...)
+	}
+	return out
+}
+
+func (m *mockClient) adapt(key string, args ...interface{}) ([]interface{}, error) {
+	if len(args) < 8 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	class := fmt.Sprint(args[0])
+	f, err := parseArgs(7, args[1:])
+	if err != nil {
+		return nil, err
+	}
+	verdict, rate, minRate, maxRate, step, factor, interval := f[0], f[1], f[2], f[3], f[4], f[5], f[6]
+	now := m.clock.Unix()
+
+	h := m.hashes[key]
+	if h == nil {
+		h = make(map[string]string)
+		m.hashes[key] = h
+	}
+	if v, ok := h[class]; ok {
+		rate, _ = strconv.ParseFloat(v, 64)
+	}
+	at := math.Inf(-1)
+	if v, ok := h[class+":at"]; ok {
+		at, _ = strconv.ParseFloat(v, 64)
+	}
+	if now-at < interval {
+		return []interface{}{int64(rate)}, nil
+	}
+	if verdict > 0 {
+		rate = math.Min(maxRate, rate+step)
 	} else {
-		allowed = int64(cost)
-		remaining = math.Floor(diff/emissionInterval + 0.5)
-		resetAfter = newTAT - now
-		m.store[key] = newTAT
-		retryAfter = -1
+		rate = math.Max(minRate, math.Floor(rate*factor))
 	}
+	h[class] = fmt.Sprintf("%g", rate)
+	h[class+":at"] = fmt.Sprintf("%g", now)
+	return []interface{}{int64(rate)}, nil
+}
 
-	return []interface{}{
-		allowed,
-		int64(remaining),
-		fmt.Sprintf("%g", retryAfter),
-		fmt.Sprintf("%g", resetAfter),
-	}, nil
+func (m *mockClient) quota(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(2, args)
+	if err != nil {
+		return nil, err
+	}
+	limit, cost := f[0], f[1]
+	used := m.store[key]
+	if used+cost > limit {
+		return []interface{}{int64(0), int64(used)}, nil
+	}
+	if cost > 0 {
+		m.store[key] = used + cost
+	}
+	return []interface{}{int64(1), int64(used + cost)}, nil
+}
+
+func (m *mockClient) acquireSlot(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(2, args)
+	if err != nil {
+		return nil, err
+	}
+	max, ttl, id := f[0], f[1], fmt.Sprint(args[2])
+	now := m.unixNow()
+
+	slots := m.slots[key]
+	if slots == nil {
+		slots = make(map[string]float64)
+		m.slots[key] = slots
+	}
+	earliest := math.Inf(1)
+	for slot, expires := range slots {
+		if expires <= now {
+			delete(slots, slot)
+			continue
+		}
+		earliest = math.Min(earliest, expires)
+	}
+	if float64(len(slots)) >= max {
+		return []interface{}{int64(0), int64(len(slots)), fmt.Sprintf("%g", earliest-now)}, nil
+	}
+	slots[id] = now + ttl
+	return []interface{}{int64(1), int64(len(slots)), "-1"}, nil
+}
+
+func (m *mockClient) renewSlot(key string, args ...interface{}) ([]interface{}, error) {
+	f, err := parseArgs(1, args)
+	if err != nil {
+		return nil, err
+	}
+	ttl, id := f[0], fmt.Sprint(args[1])
+	now := m.unixNow()
+	expires, ok := m.slots[key][id]
+	if !ok || expires <= now {
+		delete(m.slots[key], id)
+		return []interface{}{int64(0)}, nil
+	}
+	m.slots[key][id] = now + ttl
+	return []interface{}{int64(1)}, nil
+}
+
+func parseArgs(n int, args []interface{}) ([]float64, error) {
+	if len(args) < n {
+		return nil, fmt.Errorf("not enough args")
+	}
+	out := make([]float64, n)
+	for i := range out {
+		v, err := strconv.ParseFloat(fmt.Sprint(args[i]), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// scriptEpoch is the epoch the scripts measure time from, 2017-01-01 UTC.
+const scriptEpoch = 1483228800
+
+// scriptTime maps the fake clock onto the scripts' time, its start being the
+// script epoch, so that stored TATs are seconds since the start.
+func (m *mockClient) scriptTime() time.Time {
+	return time.Unix(scriptEpoch, 0).Add(m.clock.Now().Sub(m.clock.start))
+}
+
+// startEmptyKeepFull is how long the allow_n script keeps a start-empty
+// bucket after it fills.
+const startEmptyKeepFull = 86400
+
+// state returns the bucket stored under key, expiring it as Redis would.
+func (m *mockClient) state(key string) gcra.State {
+	tat, ok := m.store[key]
+	if exp, expires := m.expiry[key]; ok && expires && m.clock.Unix() >= exp {
+		delete(m.store, key)
+		delete(m.expiry, key)
+		return gcra.State{}
+	}
+	return gcra.State{TAT: tat, Exists: ok}
+}
+
+// setState stores s under key with the TTL the scripts give it.
+func (m *mockClient) setState(key string, s gcra.State) {
+	m.setStateTTL(key, s, 0)
+}
+
+// setStateTTL is like setState, keeping the key extra seconds longer.
+func (m *mockClient) setStateTTL(key string, s gcra.State, extra float64) {
+	if s.Exists {
+		now := m.clock.Unix()
+		m.store[key] = s.TAT
+		m.expiry[key] = now + math.Ceil(s.TAT-now) + extra
+	}
+}
+
+// limitArgs reads the burst, rate and period arguments of a script.
+func limitArgs(f []float64) gcra.Limit {
+	return gcra.Limit{Burst: int64(f[0]), Rate: int64(f[1]), Period: time.Duration(math.Round(f[2] * float64(time.Second)))}
+}
+
+// reply encodes res as the five fields returned by the scripts.
+func reply(res *gcra.RateLimitResult) []interface{} {
+	return []interface{}{res.Allowed, res.Remaining, seconds(res.RetryAfter), seconds(res.ResetAfter), int64(res.Reason)}
+}
+
+func seconds(d *time.Duration) string {
+	if d == nil {
+		return "-1"
+	}
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// luaNumber formats x as Lua's tostring does.
+func luaNumber(x float64) string {
+	return strconv.FormatFloat(x, 'g', 14, 64)
 }
 
 // assign copies v into rcv if types are compatible.
@@ -265,6 +823,11 @@ func assign(rcv interface{}, v interface{}) {
 		case []string:
 			*t = val
 		}
+	case *map[string]string:
+		switch val := v.(type) {
+		case map[string]string:
+			*t = val
+		}
 	case *interface{}:
 		*t = v
 	}
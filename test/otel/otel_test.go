@@ -0,0 +1,85 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestTracingSpans(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock, gcra.WithTracerProvider(tp))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	_, err := limiter.AllowNContext(ctx, "user:42", gcra.PerSecond(1, 1), 1)
+	require.NoError(t, err)
+	_, err = limiter.AllowNContext(ctx, "user:42", gcra.PerSecond(1, 1), 1)
+	require.NoError(t, err)
+	require.NoError(t, limiter.ResetContext(ctx, "user:42"))
+	parent.End()
+
+	ended := spans.Ended()
+	require.Len(t, ended, 6)
+	names := make([]string, len(ended))
+	for i, s := range ended {
+		names[i] = s.Name()
+	}
+	assert.Equal(t, []string{"gcra.EvalScript", "gcra.AllowN", "gcra.EvalScript", "gcra.AllowN", "gcra.Reset", "request"}, names)
+
+	allow := ended[1]
+	assert.Equal(t, parent.SpanContext().SpanID(), allow.Parent().SpanID())
+	assert.Equal(t, allow.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	attrs := attribute.NewSet(allow.Attributes()...)
+	v, _ := attrs.Value("gcra.allowed")
+	assert.True(t, v.AsBool())
+	v, _ = attrs.Value("gcra.limit")
+	assert.Equal(t, "1 req/s (burst 1)", v.AsString())
+	v, _ = attrs.Value("gcra.key_hash")
+	assert.NotContains(t, v.AsString(), "user")
+
+	denied := attribute.NewSet(ended[3].Attributes()...)
+	v, _ = denied.Value("gcra.allowed")
+	assert.False(t, v.AsBool())
+	v, _ = denied.Value("gcra.retry_after")
+	assert.Equal(t, 1.0, v.AsFloat64())
+}
+
+func TestMeterProvider(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	mock := testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0)))
+	limiter := gcra.NewLimiter(mock, gcra.WithMeterProvider(mp))
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Allow("user:42", gcra.PerSecond(2, 2))
+		require.NoError(t, err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	got := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					decision, _ := dp.Attributes.Value("gcra.decision")
+					got[m.Name+"/"+decision.AsString()] = dp.Value
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"gcra.requests/allowed": 2, "gcra.requests/denied": 1}, got)
+}
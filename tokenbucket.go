@@ -0,0 +1,59 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"time"
+)
+
+// TokenBucket describes a limit the way token bucket libraries such as
+// golang.org/x/time/rate do: a bucket holding up to Capacity tokens, refilled
+// with Refill tokens every Interval, that starts full unless StartEmpty is
+// set. Tokens are added continuously rather than in steps, so a bucket
+// refilled with 10 tokens every second gains one every 100ms.
+//
+// A TokenBucket is stored as a GCRA limit of Refill per Interval with burst
+// Capacity; Limit returns it.
+type TokenBucket struct {
+	Capacity int64         // tokens the bucket holds, and so the largest burst; must be > 0
+	Refill   int64         // tokens added every Interval; must be > 0
+	Interval time.Duration // must be > 0
+
+	// StartEmpty makes a key seen for the first time, or after Reset, start
+	// with no tokens rather than a full bucket. Such keys are kept in Redis
+	// for a day after the bucket fills, so an idle key comes back full;
+	// one idle for longer is forgotten and starts empty again.
+	StartEmpty bool
+}
+
+// Limit returns the GCRA limit enforcing b. Its Burst is b's Capacity.
+func (b TokenBucket) Limit() Limit {
+	return Limit{Rate: b.Refill, Period: b.Interval, Burst: b.Capacity}
+}
+
+// validate reports a *LimitError naming the TokenBucket field at fault.
+func (b TokenBucket) validate() error {
+	switch {
+	case b.Capacity <= 0:
+		return &LimitError{Limit: b.Limit(), Field: "Capacity", Msg: "must be greater than zero"}
+	case b.Refill <= 0:
+		return &LimitError{Limit: b.Limit(), Field: "Refill", Msg: "must be greater than zero"}
+	case b.Interval <= 0:
+		return &LimitError{Limit: b.Limit(), Field: "Interval", Msg: "must be greater than zero"}
+	}
+	return nil
+}
+
+// AllowBucket takes n tokens from the bucket for key if it holds them. It is
+// AllowN with b's Limit, except that a new bucket may start empty, and the
+// result's Remaining is the number of tokens left in the bucket.
+func (l Limiter) AllowBucket(key string, b TokenBucket, n int64) (*RateLimitResult, error) {
+	return l.AllowBucketContext(context.Background(), key, b, n)
+}
+
+// AllowBucketContext is like AllowBucket, tracing the call as a child of ctx.
+func (l Limiter) AllowBucketContext(ctx context.Context, key string, b TokenBucket, n int64) (*RateLimitResult, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return l.allowN(ctx, "", key, b.Limit(), n, allowOpts{startEmpty: b.StartEmpty})
+}
@@ -0,0 +1,87 @@
+package leakybucketgcra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestTokenBucketStartsFull(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	bucket := gcra.TokenBucket{Capacity: 5, Refill: 10, Interval: time.Second}
+	assert.Equal(t, gcra.PerSecond(10, 5), bucket.Limit())
+
+	res, err := limiter.AllowBucket("api", bucket, 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	res, err = limiter.AllowBucket("api", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.InDelta(t, 100*time.Millisecond, *res.RetryAfter, float64(time.Microsecond))
+}
+
+func TestTokenBucketStartEmpty(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	bucket := gcra.TokenBucket{Capacity: 4, Refill: 2, Interval: time.Second, StartEmpty: true}
+
+	res, err := limiter.AllowBucket("api", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, *res.RetryAfter)
+	assert.Equal(t, 2*time.Second, *res.ResetAfter)
+
+	// The empty bucket was stored, so it fills from the first request.
+	clock.Advance(time.Second)
+	res, err = limiter.AllowBucket("api", bucket, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// Once full it stays capped at Capacity, and idling does not empty it
+	// again although the bucket's own TTL has passed.
+	clock.Advance(time.Minute)
+	res, err = limiter.AllowBucket("api", bucket, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), res.Allowed)
+	clock.Advance(time.Hour)
+	res, err = limiter.AllowBucket("api", bucket, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), res.Allowed)
+
+	// A key idle for more than a day after filling is forgotten.
+	clock.Advance(25 * time.Hour)
+	res, err = limiter.AllowBucket("api", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+
+	// Reset empties the bucket again.
+	require.NoError(t, limiter.Reset("api"))
+	res, err = limiter.AllowBucket("api", bucket, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Allowed)
+}
+
+func TestTokenBucketValidation(t *testing.T) {
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))))
+	for _, bucket := range []gcra.TokenBucket{
+		{Capacity: 0, Refill: 1, Interval: time.Second},
+		{Capacity: 1, Refill: 0, Interval: time.Second},
+		{Capacity: 1, Refill: 1},
+	} {
+		_, err := limiter.AllowBucket("api", bucket, 1)
+		var limitErr *gcra.LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.ErrorIs(t, err, gcra.ErrInvalidLimit)
+	}
+	_, err := limiter.AllowBucket("api", gcra.TokenBucket{Refill: 1, Interval: time.Second}, 1)
+	assert.ErrorContains(t, err, "Capacity must be greater than zero")
+}
@@ -0,0 +1,269 @@
+package leakybucketgcra
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// reservationOverdraft is how far Reserve may run a bucket into debt. Like
+// golang.org/x/time/rate, reservations are in practice unbounded.
+const reservationOverdraft = math.MaxInt32
+
+// RateLimiter is one key of a Limiter with the method set of
+// golang.org/x/time/rate.Limiter, so that code written against it can limit
+// across processes by changing only its constructor:
+//
+//	lim := rate.NewLimiter(10, 20)
+//
+// becomes
+//
+//	lim := gcra.NewRateLimiter(limiter, "api:acme", gcra.PerSecond(10, 20))
+//
+// Decisions are made in Redis by its clock, so the time arguments of AllowN
+// and ReserveN are ignored. Backend errors deny events unless the Limiter
+// fails open; WaitN returns them. Every decision is reported to the
+// Recorder under Limit.String of the RateLimiter's current limit. A
+// RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	l   *Limiter
+	key string
+
+	mu    sync.Mutex
+	limit Limit
+	inf   bool // set by SetLimit(rate.Inf)
+}
+
+// NewRateLimiter returns a RateLimiter enforcing limit on key through l.
+// limit must be a GCRA limit; its Rate per Period is the refill rate and its
+// Burst the bucket size.
+func NewRateLimiter(l *Limiter, key string, limit Limit) *RateLimiter {
+	return &RateLimiter{l: l, key: key, limit: limit}
+}
+
+// Limit returns the rate at which tokens are added to the bucket, in tokens
+// per second.
+func (r *RateLimiter) Limit() rate.Limit {
+	limit, inf := r.snapshot()
+	switch {
+	case inf:
+		return rate.Inf
+	case limit.Rate <= 0 || limit.Period <= 0:
+		return 0
+	}
+	return rate.Limit(float64(limit.Rate) / limit.Period.Seconds())
+}
+
+// Burst returns the bucket size.
+func (r *RateLimiter) Burst() int {
+	limit, _ := r.snapshot()
+	return int(limit.Burst)
+}
+
+// SetLimit changes the rate at which tokens are added to the bucket for
+// this RateLimiter; other processes keep their own limits. rate.Inf allows
+// every event without consulting Redis, and a limit of zero or less allows
+// none. Whole rates become a Limit of that many per second, others one
+// token per 1/newLimit.
+func (r *RateLimiter) SetLimit(newLimit rate.Limit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inf = newLimit == rate.Inf
+	if r.inf {
+		return
+	}
+	switch {
+	case newLimit <= 0:
+		r.limit.Rate, r.limit.Period = 0, time.Second
+	case newLimit == rate.Limit(math.Trunc(float64(newLimit))) && newLimit < math.MaxInt32:
+		r.limit.Rate, r.limit.Period = int64(newLimit), time.Second
+	default:
+		r.limit.Rate = 1
+		r.limit.Period = max(time.Duration(math.Round(float64(time.Second)/float64(newLimit))), 1)
+	}
+}
+
+// SetBurst changes the bucket size for this RateLimiter.
+func (r *RateLimiter) SetBurst(newBurst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limit.Burst = int64(newBurst)
+}
+
+// Allow is a shortcut for AllowN(time.Now(), 1).
+func (r *RateLimiter) Allow() bool {
+	return r.AllowN(time.Now(), 1)
+}
+
+// AllowN reports whether n events may happen now, taking their tokens if
+// so. Use it to drop or skip events that exceed the limit.
+func (r *RateLimiter) AllowN(_ time.Time, n int) bool {
+	limit, inf := r.snapshot()
+	switch {
+	case inf:
+		return true
+	case limit.Rate <= 0:
+		return false
+	}
+	res, err := r.l.allowN(context.Background(), limit.String(), r.key, limit, int64(n), allowOpts{})
+	return err == nil && res.Err() == nil
+}
+
+// Reserve is a shortcut for ReserveN(time.Now(), 1).
+func (r *RateLimiter) Reserve() *Reservation {
+	return r.ReserveN(time.Now(), 1)
+}
+
+// ReserveN takes n tokens now, even from an empty bucket, and returns a
+// Reservation saying how long the caller must wait before the n events may
+// happen. Tokens taken from an empty bucket are borrowed as an Overdraft, so
+// other callers of the key are delayed until they are repaid. The
+// Reservation is not OK when n exceeds the burst or the backend fails.
+func (r *RateLimiter) ReserveN(_ time.Time, n int) *Reservation {
+	res, _ := r.reserve(context.Background(), n)
+	return res
+}
+
+// Wait is a shortcut for WaitN(ctx, 1).
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	return r.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n events may happen. It returns an error, without
+// taking tokens, when n exceeds the burst, ctx is done, or the wait would
+// outlast ctx's deadline; and the backend's error when Redis fails.
+func (r *RateLimiter) WaitN(ctx context.Context, n int) error {
+	limit, inf := r.snapshot()
+	if !inf && int64(n) > limit.Burst {
+		return fmt.Errorf("%w: wait for %d tokens, burst is %d", ErrCostExceedsBurst, n, limit.Burst)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, err := r.reserve(ctx, n)
+	if err != nil {
+		return err
+	}
+	if !res.OK() {
+		return fmt.Errorf("%w: limit is zero", ErrLimited)
+	}
+	now := time.Now()
+	delay := res.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		res.CancelAt(now)
+		return fmt.Errorf("%w: wait for %d tokens would exceed context deadline", ErrLimited, n)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		res.Cancel()
+		return ctx.Err()
+	}
+}
+
+func (r *RateLimiter) snapshot() (Limit, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limit, r.inf
+}
+
+// reserve implements ReserveN. It returns a Reservation that is not OK along
+// with any error.
+func (r *RateLimiter) reserve(ctx context.Context, n int) (*Reservation, error) {
+	limit, inf := r.snapshot()
+	now := time.Now()
+	switch {
+	case inf:
+		return &Reservation{ok: true, timeToAct: now}, nil
+	case limit.Rate <= 0 || int64(n) > limit.Burst:
+		return &Reservation{}, nil
+	}
+
+	// Named after limit, not debt, so reservations are recorded with AllowN.
+	debt := limit
+	debt.Overdraft = reservationOverdraft
+	res, err := r.l.allowN(ctx, limit.String(), r.key, debt, int64(n), allowOpts{})
+	if err != nil {
+		return &Reservation{}, err
+	}
+	if err := res.Err(); err != nil {
+		return &Reservation{}, err
+	}
+
+	// The tokens are available once the bucket is no longer in debt, that
+	// is when it would hold no more than Burst tokens' worth of delay.
+	var delay time.Duration
+	if res.ResetAfter != nil {
+		full := time.Duration(float64(limit.Period) * float64(limit.Burst) / float64(limit.Rate))
+		delay = max(*res.ResetAfter-full, 0)
+	}
+	return &Reservation{r: r, ok: true, limit: limit, tokens: int64(n), timeToAct: now.Add(delay)}, nil
+}
+
+// Reservation holds tokens taken by RateLimiter.ReserveN for events that may
+// happen after a delay, like golang.org/x/time/rate.Reservation.
+type Reservation struct {
+	r         *RateLimiter
+	ok        bool
+	limit     Limit // the limit the tokens were taken under
+	tokens    int64
+	timeToAct time.Time
+	cancel    sync.Once
+}
+
+// OK reports whether the tokens were taken. Delay and Cancel are meaningful
+// only for OK reservations.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is a shortcut for DelayFrom(time.Now()).
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+// DelayFrom returns how long after now the reserved events may happen: zero
+// means at once, and rate.InfDuration that the reservation is not OK.
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return rate.InfDuration
+	}
+	return max(r.timeToAct.Sub(now), 0)
+}
+
+// Cancel is a shortcut for CancelAt(time.Now()).
+func (r *Reservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+// CancelAt gives the reserved tokens back to the bucket, so that later
+// events need not wait for them, if the reservation's delay has not yet
+// passed at now. Only the first call has an effect.
+//
+// Unlike golang.org/x/time/rate, which keeps back the tokens that later
+// reservations were granted against, CancelAt returns all of the reserved
+// tokens: reservations made since, possibly by other processes, are not
+// known to it. Their holders still wait their original delays, but new
+// callers may be let in ahead of them, briefly exceeding the limit by up to
+// the cancelled tokens.
+func (r *Reservation) CancelAt(now time.Time) {
+	if !r.ok || r.tokens == 0 || !now.Before(r.timeToAct) {
+		return
+	}
+	r.cancel.Do(func() {
+		// Best effort: tokens that cannot be returned are spent.
+		r.r.l.returnTokens(context.Background(), r.r.key, r.limit, r.tokens)
+	})
+}
@@ -0,0 +1,128 @@
+package leakybucketgcra_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	gcra "github.com/sagarsuperuser/leaky-bucket-gcra"
+	testmock "github.com/sagarsuperuser/leaky-bucket-gcra/test/mock"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	lim := gcra.NewRateLimiter(limiter, "api", gcra.PerSecond(10, 2))
+	assert.Equal(t, rate.Limit(10), lim.Limit())
+	assert.Equal(t, 2, lim.Burst())
+
+	assert.True(t, lim.Allow())
+	assert.True(t, lim.Allow())
+	assert.False(t, lim.Allow())
+	assert.False(t, lim.AllowN(time.Now(), 3))
+
+	clock.Advance(101 * time.Millisecond)
+	assert.True(t, lim.Allow())
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	lim := gcra.NewRateLimiter(limiter, "api", gcra.PerSecond(10, 1))
+	const slack = float64(20 * time.Millisecond)
+
+	r := lim.Reserve()
+	require.True(t, r.OK())
+	assert.Zero(t, r.Delay())
+
+	// An empty bucket still reserves, at the cost of waiting.
+	r = lim.Reserve()
+	require.True(t, r.OK())
+	assert.InDelta(t, 100*time.Millisecond, r.Delay(), slack)
+	last := lim.Reserve()
+	require.True(t, last.OK())
+	assert.InDelta(t, 200*time.Millisecond, last.Delay(), slack)
+
+	// The debt delays everyone else on the key.
+	assert.False(t, lim.Allow())
+
+	// Cancelling gives the tokens back.
+	last.Cancel()
+	r = lim.Reserve()
+	require.True(t, r.OK())
+	assert.InDelta(t, 200*time.Millisecond, r.Delay(), slack)
+
+	r = lim.ReserveN(time.Now(), 2)
+	assert.False(t, r.OK())
+	assert.Equal(t, rate.InfDuration, r.Delay())
+}
+
+func TestRateLimiterRecordsOneName(t *testing.T) {
+	rec := &decisionRecorder{}
+	limiter := gcra.NewLimiter(testmock.NewMockClient(testmock.NewTestTime(time.Unix(0, 0))), gcra.WithRecorder(rec))
+	limit := gcra.PerSecond(10, 2)
+	lim := gcra.NewRateLimiter(limiter, "api", limit)
+
+	lim.Allow()
+	lim.Reserve()
+	assert.Equal(t, []string{limit.String(), limit.String()}, rec.names)
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	ctx := context.Background()
+
+	lim := gcra.NewRateLimiter(limiter, "fast", gcra.PerSecond(100, 1))
+	require.NoError(t, lim.Wait(ctx))
+	start := time.Now()
+	require.NoError(t, lim.Wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+
+	lim = gcra.NewRateLimiter(limiter, "slow", gcra.PerSecond(1, 1))
+	require.NoError(t, lim.Wait(ctx))
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, lim.Wait(short), gcra.ErrLimited)
+
+	// The refused wait took no tokens.
+	clock.Advance(time.Second)
+	assert.True(t, lim.Allow())
+
+	assert.ErrorIs(t, lim.WaitN(ctx, 2), gcra.ErrCostExceedsBurst)
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, lim.Wait(done), context.Canceled)
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	clock := testmock.NewTestTime(time.Unix(0, 0))
+	limiter := gcra.NewLimiter(testmock.NewMockClient(clock))
+	lim := gcra.NewRateLimiter(limiter, "api", gcra.PerSecond(1, 1))
+	assert.True(t, lim.Allow())
+	assert.False(t, lim.Allow())
+
+	lim.SetLimit(rate.Inf)
+	assert.Equal(t, rate.Inf, lim.Limit())
+	assert.True(t, lim.AllowN(time.Now(), 100))
+	require.NoError(t, lim.WaitN(context.Background(), 100))
+
+	lim.SetLimit(0.5)
+	lim.SetBurst(2)
+	assert.Equal(t, rate.Limit(0.5), lim.Limit())
+	assert.Equal(t, 2, lim.Burst())
+	assert.True(t, lim.Allow())
+	assert.False(t, lim.Allow())
+	clock.Advance(2 * time.Second)
+	assert.True(t, lim.Allow())
+
+	lim.SetLimit(0)
+	assert.Equal(t, rate.Limit(0), lim.Limit())
+	assert.False(t, lim.Allow())
+	assert.False(t, lim.Reserve().OK())
+	assert.ErrorIs(t, lim.Wait(context.Background()), gcra.ErrLimited)
+}